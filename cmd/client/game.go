@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// game is the player's membership of one Peril game. Its subscriptions run on
+// a dedicated connection so that leaving the game cancels all of them at once.
+type game struct {
+	id     string                                   // Game ID used in routing keys and queue names
+	state  *gamelogic.GameState                     // The player's units in this game
+	conn   pubsub.Transport                         // Connection owned by the game
+	t      pubsub.Transport                         // Signing wrapper around conn
+	moves  pubsub.Route[gamelogic.ArmyMove]         // Route moves are published on
+	wars   pubsub.Route[gamelogic.RecognitionOfWar] // Route wars are published on
+	worlds chan gamelogic.WorldState                // World states the server sent us
+
+	started atomic.Bool // Whether the server has started the game
+}
+
+// joinGame connects to a game the lobby admitted us to and subscribes to its
+// start signal, moves, pauses, war results, treasury, territories changing
+// hands, turns and end.
+func joinGame(
+	id string,
+	identity gamelogic.Identity,
+	keys *pubsub.Keyring,
+	dial func() (pubsub.Transport, error),
+	moves pubsub.Route[gamelogic.ArmyMove],
+	wars pubsub.Route[gamelogic.RecognitionOfWar],
+) (*game, error) {
+	if err := routing.ValidateGameID(id); err != nil {
+		return nil, err
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect: %w", err)
+	}
+	g := &game{
+		id:     id,
+		state:  gamelogic.NewGameState(identity.Username),
+		conn:   conn,
+		t:      pubsub.NewSignedTransport(conn, identity.Username, identity.PrivateKey, keys),
+		moves:  moves,
+		wars:   wars,
+		worlds: make(chan gamelogic.WorldState, 1),
+	}
+	if err := g.subscribe(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Play with the server's map and rules; handlerWorldState installs them
+	ws, err := g.queryWorld()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not get the game's scenario: %w", err)
+	}
+	fmt.Printf("Playing scenario %s on the %s map\n", ws.Scenario.Name, ws.Scenario.Map.Name)
+	return g, nil
+}
+
+// worldTimeout is how long to wait for the server to describe the world.
+const worldTimeout = 5 * time.Second
+
+// subscribe starts consuming the game's traffic.
+func (g *game) subscribe() error {
+	username := g.state.GetUsername()
+
+	// Learn when every player is ready
+	err := pubsub.SubscribeRoute(
+		g.t,
+		routes.GameStarts,
+		queueName(routing.GameStartPrefix, g.id, username),
+		handlerGameStart(g),
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to game start: %w", err)
+	}
+
+	// Subscribe to army moves topic exchange for every player's moves in this game
+	err = pubsub.SubscribeRoute(
+		g.t,
+		g.moves,
+		queueName(routing.ArmyMovesPrefix, g.id, username),
+		handlerMove(g.state, g.t, g.wars, g.id),
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to army moves: %w", err)
+	}
+
+	// Subscribe to pause/resume messages via direct exchange
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.Pause,
+		queueName(routing.PauseKey, g.id, username),
+		handlerPause(g.state),
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to pause: %w", err)
+	}
+
+	// The server resolves wars and tells both sides the result. The queue is
+	// our own and durable, so results of wars fought while we were
+	// disconnected are waiting when we join again.
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.WarResults,
+		queueName(routing.WarPrefix, username, g.id),
+		handlerWarResult(g.state),
+		username,
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to war results: %w", err)
+	}
+
+	// Receive the server's view of the game, asked for or not
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.WorldStates,
+		queueName(routing.WorldStatePrefix, g.id, username),
+		handlerWorldState(g),
+		g.id,
+		username,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to world state: %w", err)
+	}
+
+	// Learn what our gold is whenever our territories pay
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.Treasuries,
+		queueName(routing.TreasuryPrefix, g.id, username),
+		handlerTreasury(g.state),
+		g.id,
+		username,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to treasury: %w", err)
+	}
+
+	// Learn who owns what as territories change hands
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.Ownership,
+		queueName(routing.OwnershipPrefix, g.id, username),
+		handlerOwnership(g.state),
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to ownership: %w", err)
+	}
+
+	// Learn when the game has been won
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.GameOvers,
+		queueName(routing.GameOverPrefix, g.id, username),
+		handlerGameOver(g.state),
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to game over: %w", err)
+	}
+
+	// Follow the turns of a turn-based game
+	err = pubsub.SubscribeRoute(
+		g.t,
+		routes.Turns,
+		queueName(routing.TurnPrefix, g.id, username),
+		handlerTurn(g),
+		g.id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to turns: %w", err)
+	}
+	return nil
+}
+
+// publishMove announces a move to every player of the game.
+func (g *game) publishMove(mv gamelogic.ArmyMove) error {
+	return pubsub.PublishRoute(g.t, g.moves, mv, g.id, mv.Player.Username)
+}
+
+// publishSpawn tells the server about a unit we brought into the game.
+func (g *game) publishSpawn(spawn gamelogic.UnitSpawn) error {
+	return pubsub.PublishRoute(g.t, routes.Spawns, spawn, g.id, spawn.Username)
+}
+
+// publishOrders sends the orders we gave during a turn to the server.
+func (g *game) publishOrders(o gamelogic.Orders) error {
+	return pubsub.PublishRoute(g.t, routes.Orders, o, g.id, o.Username)
+}
+
+// queryWorld asks the server for the authoritative state of the game and
+// waits for its answer, which handlerWorldState delivers.
+func (g *game) queryWorld() (gamelogic.WorldState, error) {
+	// Drop states that nobody asked for
+	for len(g.worlds) > 0 {
+		<-g.worlds
+	}
+	query := routing.WorldQuery{Username: g.state.GetUsername(), Game: g.id}
+	if err := pubsub.PublishRoute(g.t, routes.WorldQueries, query); err != nil {
+		return gamelogic.WorldState{}, err
+	}
+	select {
+	case ws := <-g.worlds:
+		if ws.Error != "" {
+			return ws, errors.New(ws.Error)
+		}
+		return ws, nil
+	case <-time.After(worldTimeout):
+		return gamelogic.WorldState{}, errors.New("the server did not answer; is it running?")
+	}
+}
+
+// close leaves the game, cancelling its subscriptions.
+func (g *game) close() error {
+	return g.conn.Close()
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"time"
+	"maps"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // Handler for pause/resume messages from the direct pause exchange
@@ -19,8 +19,61 @@ func handlerPause(gs *gamelogic.GameState) func(routing.PlayingState) pubsub.Ack
 	}
 }
 
+// Handler for the server's key directory. Directories must be signed by the
+// server key pinned in keys, which they cannot replace.
+func handlerKeyDirectory(keys *pubsub.Keyring) func(pubsub.Message) pubsub.AckType {
+	return func(msg pubsub.Message) pubsub.AckType {
+		var dir routing.KeyDirectory
+		if err := json.Unmarshal(msg.Body, &dir); err != nil {
+			fmt.Printf("error: could not decode key directory: %v\n", err)
+			return pubsub.NackDiscard
+		}
+
+		signer, err := pubsub.Verify(msg, keys)
+		if err != nil || signer != dir.Author() {
+			fmt.Printf("error: rejecting key directory signed by %q: %v\n", signer, err)
+			return pubsub.NackDiscard
+		}
+
+		for username, key := range dir.Keys {
+			if username == routing.ServerIdentity {
+				continue
+			}
+			if routing.ValidateUsername(username) != nil {
+				fmt.Printf("error: ignoring key for invalid username %q\n", username)
+				continue
+			}
+			if err := keys.Add(username, key); err != nil {
+				fmt.Printf("error: %v\n", err)
+			}
+		}
+		for username, key := range dir.EncryptionKeys {
+			if routing.ValidateUsername(username) != nil {
+				fmt.Printf("error: ignoring encryption key for invalid username %q\n", username)
+				continue
+			}
+			if err := keys.AddEncryptionKey(username, key); err != nil {
+				fmt.Printf("error: %v\n", err)
+			}
+		}
+		return pubsub.Ack
+	}
+}
+
+// Handler for private messages sealed for this player
+func handlerWhisper(gs *gamelogic.GameState) func(routing.Whisper) pubsub.AckType {
+	return func(w routing.Whisper) pubsub.AckType {
+		defer fmt.Print("> ")
+		if w.To != gs.GetUsername() {
+			return pubsub.NackDiscard
+		}
+		gs.HandleWhisper(w)
+		return pubsub.Ack
+	}
+}
+
 // Handler for player's army move messages from the topic exchange
-func handlerMove(gs *gamelogic.GameState, ch *amqp.Channel) func(gamelogic.ArmyMove) pubsub.AckType {
+func handlerMove(gs *gamelogic.GameState, t pubsub.Transport, wars pubsub.Route[gamelogic.RecognitionOfWar], gameID string) func(gamelogic.ArmyMove) pubsub.AckType {
 	return func(move gamelogic.ArmyMove) pubsub.AckType {
 		defer fmt.Print("> ")
 
@@ -30,14 +83,16 @@ func handlerMove(gs *gamelogic.GameState, ch *amqp.Channel) func(gamelogic.ArmyM
 		case gamelogic.MoveOutComeSafe:
 			return pubsub.Ack
 		case gamelogic.MoveOutcomeMakeWar:
-			err := pubsub.PublishJSON(
-				ch,
-				routing.ExchangePerilTopic,
-				routing.WarRecognitionsPrefix+"."+gs.GetUsername(),
+			err := pubsub.PublishRoute(
+				t,
+				wars,
 				gamelogic.RecognitionOfWar{
 					Attacker: move.Player,
 					Defender: gs.GetPlayerSnap(),
-				})
+				},
+				gameID,
+				gs.GetUsername(),
+			)
 			if err != nil {
 				fmt.Printf("error: %s\n", err)
 				return pubsub.NackRequeue
@@ -52,60 +107,134 @@ func handlerMove(gs *gamelogic.GameState, ch *amqp.Channel) func(gamelogic.ArmyM
 	}
 }
 
-func handlerWar(gs *gamelogic.GameState, ch *amqp.Channel) func(gamelogic.RecognitionOfWar) pubsub.AckType {
-	return func(war gamelogic.RecognitionOfWar) pubsub.AckType {
+// Handler for the server's verdict on a war we fought in
+func handlerWarResult(gs *gamelogic.GameState) func(gamelogic.WarResult) pubsub.AckType {
+	return func(result gamelogic.WarResult) pubsub.AckType {
 		defer fmt.Print("> ")
+		gs.HandleWarResult(result)
+		return pubsub.Ack
+	}
+}
 
-		warOutcome, winner, loser := gs.HandleWar(war)
-
-		var ackType pubsub.AckType
-		var logMessage string
-		publishLog := false
-
-		switch warOutcome {
-		case gamelogic.WarOutcomeNotInvolved:
-			ackType = pubsub.NackRequeue
-		case gamelogic.WarOutcomeNoUnits:
-			ackType = pubsub.NackDiscard
-		case gamelogic.WarOutcomeOpponentWon:
-			ackType = pubsub.Ack
-			publishLog = true
-			logMessage = fmt.Sprintf("%s won a war against %s", winner, loser)
-		case gamelogic.WarOutcomeYouWon:
-			ackType = pubsub.Ack
-			publishLog = true
-			logMessage = fmt.Sprintf("%s won a war against %s", winner, loser)
-		case gamelogic.WarOutcomeDraw:
-			ackType = pubsub.Ack
-			publishLog = true
-			logMessage = fmt.Sprintf("A war between %s and %s resulted in a draw", winner, loser)
+// Handler for the server's answers to our lobby requests
+func handlerLobbyReply(replies chan<- routing.LobbyReply) func(routing.LobbyReply) pubsub.AckType {
+	return func(reply routing.LobbyReply) pubsub.AckType {
+		select {
+		case replies <- reply:
 		default:
-			fmt.Println("error: unknown move outcome")
-			ackType = pubsub.NackDiscard
+			// Nobody is waiting for this answer any more
 		}
+		return pubsub.Ack
+	}
+}
 
-		if publishLog {
-			err := publishGameLog(ch, gs.GetUsername(), logMessage)
-			if err != nil {
-				fmt.Printf("error publishing game log: %v\n", err)
-				return pubsub.NackRequeue
+// Handler for the server's signal that our game has started
+func handlerGameStart(g *game) func(routing.GameStart) pubsub.AckType {
+	return func(start routing.GameStart) pubsub.AckType {
+		defer fmt.Print("> ")
+		if start.Game != g.id {
+			return pubsub.NackDiscard
+		}
+		g.started.Store(true)
+		fmt.Println()
+		fmt.Printf("==== Game %s started with %v ====\n", start.Game, start.Players)
+		return pubsub.Ack
+	}
+}
+
+// Handler for the server's announcements of players coming and going
+func handlerPresence(username string) func(routing.PresenceEvent) pubsub.AckType {
+	return func(ev routing.PresenceEvent) pubsub.AckType {
+		if ev.Username == username {
+			return pubsub.Ack
+		}
+		defer fmt.Print("> ")
+		fmt.Println()
+		switch ev.Kind {
+		case routing.PresenceJoined:
+			fmt.Printf("==== %s is online ====\n", ev.Username)
+		case routing.PresenceLeft:
+			fmt.Printf("==== %s quit ====\n", ev.Username)
+		case routing.PresenceTimedOut:
+			fmt.Printf("==== %s lost connection ====\n", ev.Username)
+		}
+		return pubsub.Ack
+	}
+}
+
+// Handler for the server's authoritative state of the game. If it disagrees
+// with our own army, the server's view wins.
+func handlerWorldState(g *game) func(gamelogic.WorldState) pubsub.AckType {
+	return func(ws gamelogic.WorldState) pubsub.AckType {
+		if ws.Error == "" && ws.Scenario.Name != "" {
+			g.state.SetScenario(&ws.Scenario)
+		}
+		if ws.Error == "" {
+			if t, ok := ws.Treasury(g.state.GetUsername()); ok {
+				g.state.SetTreasury(t)
 			}
+			if ws.Owners != nil {
+				g.state.SetOwners(ws.Owners)
+			}
+			g.state.SkipUnitIDs(ws.LastIDs[g.state.GetUsername()])
+			if p, ok := ws.Player(g.state.GetUsername()); ok && !maps.Equal(p.Units, g.state.GetPlayerSnap().Units) {
+				g.state.ReplaceUnits(p.Units)
+				fmt.Println()
+				if g.state.TurnBased() {
+					fmt.Println("Your army has carried out the turn's orders; see status")
+				} else {
+					fmt.Println("Your army was out of sync with the server and has been corrected; see status")
+				}
+				fmt.Print("> ")
+			}
+		}
+		// Hand the state to a waiting world command, if there is one
+		select {
+		case g.worlds <- ws:
+		default:
 		}
+		return pubsub.Ack
+	}
+}
 
-		return ackType
+// Handler for the server's account of our gold
+func handlerTreasury(gs *gamelogic.GameState) func(gamelogic.Treasury) pubsub.AckType {
+	return func(t gamelogic.Treasury) pubsub.AckType {
+		gs.SetTreasury(t)
+		return pubsub.Ack
+	}
+}
 
+// Handler for territories changing hands
+func handlerOwnership(gs *gamelogic.GameState) func(gamelogic.OwnershipChange) pubsub.AckType {
+	return func(ch gamelogic.OwnershipChange) pubsub.AckType {
+		defer fmt.Print("> ")
+		gs.HandleOwnership(ch)
+		return pubsub.Ack
 	}
 }
 
-func publishGameLog(ch *amqp.Channel, username, message string) error {
-	gameLog := routing.GameLog{
-		Message:     message,
-		CurrentTime: time.Now(),
-		Username:    username,
+// Handler for the end of the game
+func handlerGameOver(gs *gamelogic.GameState) func(gamelogic.GameOver) pubsub.AckType {
+	return func(over gamelogic.GameOver) pubsub.AckType {
+		defer fmt.Print("> ")
+		gs.HandleGameOver(over)
+		return pubsub.Ack
 	}
-	err := pubsub.PublishGob(ch, routing.ExchangePerilTopic, routing.GameLogSlug+"."+username, gameLog)
-	if err != nil {
-		return fmt.Errorf("could not publish game log: %w", err)
+}
+
+// Handler for the server's turn clock. When a turn ends, the orders we gave
+// during it are sent to the server to be resolved with everyone else's.
+func handlerTurn(g *game) func(gamelogic.TurnEvent) pubsub.AckType {
+	return func(ev gamelogic.TurnEvent) pubsub.AckType {
+		defer fmt.Print("> ")
+		orders, ended := g.state.HandleTurn(ev)
+		if !ended {
+			return pubsub.Ack
+		}
+		if err := g.publishOrders(orders); err != nil {
+			fmt.Printf("error: could not send your orders: %v\n", err)
+		}
+		return pubsub.Ack
 	}
-	return nil
 }
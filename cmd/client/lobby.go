@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// lobbyTimeout is how long to wait for the server to answer a lobby request.
+const lobbyTimeout = 5 * time.Second
+
+// lobbyRequest sends cmd to the server's lobby and waits for its answer,
+// which handlerLobbyReply delivers on replies.
+func lobbyRequest(t pubsub.Transport, replies <-chan routing.LobbyReply, cmd routing.LobbyCommand) (routing.LobbyReply, error) {
+	// Drop answers to earlier requests that timed out
+	for len(replies) > 0 {
+		<-replies
+	}
+	if err := pubsub.PublishRoute(t, routes.LobbyCommands, cmd); err != nil {
+		return routing.LobbyReply{}, err
+	}
+
+	timeout := time.After(lobbyTimeout)
+	for {
+		select {
+		case reply := <-replies:
+			if reply.Action != cmd.Action {
+				continue
+			}
+			if reply.Error != "" {
+				return reply, errors.New(reply.Error)
+			}
+			return reply, nil
+		case <-timeout:
+			return routing.LobbyReply{}, errors.New("the server did not answer; is it running?")
+		}
+	}
+}
+
+// printRooms lists the lobby's game rooms.
+func printRooms(rooms []routing.GameRoom) {
+	if len(rooms) == 0 {
+		fmt.Println("No games yet; create one with create <game>")
+		return
+	}
+	for _, room := range rooms {
+		fmt.Printf("* %s [%s] %d/%d players: %v (ready: %v)\n",
+			room.ID, room.State, len(room.Players), room.MaxPlayers, room.Players, room.Ready)
+	}
+}
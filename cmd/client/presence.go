@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// sendHeartbeats tells the server we are online, and which game we are in,
+// every presence.HeartbeatInterval until stop is closed.
+func sendHeartbeats(t pubsub.Transport, username string, game *atomic.Value, stop <-chan struct{}) {
+	ticker := time.NewTicker(presence.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		current, _ := game.Load().(string)
+		if err := publishHeartbeat(t, username, current, false); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// publishHeartbeat sends one heartbeat, or announces that we are quitting.
+func publishHeartbeat(t pubsub.Transport, username, game string, leaving bool) error {
+	hb := routing.Heartbeat{Username: username, Game: game, SentAt: time.Now(), Leaving: leaving}
+	if err := pubsub.PublishRoute(t, routes.Heartbeats, hb, username); err != nil {
+		return fmt.Errorf("could not publish heartbeat: %w", err)
+	}
+	return nil
+}
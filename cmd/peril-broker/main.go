@@ -0,0 +1,69 @@
+// Command peril-broker runs a standalone message broker so a Peril game can be
+// hosted on a LAN without RabbitMQ. Clients connect with -transport stomp.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/broker"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+func main() {
+	addr := flag.String("addr", ":61613", "address to accept STOMP clients on")
+	login := flag.String("login", "", "require clients to log in with this login")
+	passcode := flag.String("passcode", "", "passcode required together with -login")
+	flag.Parse()
+
+	b := broker.NewPeril()
+	b.HeartBeat = 10 * time.Second
+	if *login != "" {
+		b.Credentials = map[string]string{*login: *passcode}
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("could not listen on %s: %v", *addr, err)
+	}
+	go func() {
+		if err := b.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Fatalf("broker stopped: %v", err)
+		}
+	}()
+	fmt.Printf("Peril broker accepting STOMP clients on %s\n", ln.Addr())
+
+	printHelp()
+	for {
+		input := gamelogic.GetInput()
+		if len(input) == 0 {
+			continue
+		}
+		switch input[0] {
+		case "queues":
+			for _, q := range b.Queues() {
+				fmt.Printf("* %s: %d ready, %d unacked, %d consumer(s)\n", q.Name, q.Ready, q.Unacked, q.Consumers)
+			}
+		case "help":
+			printHelp()
+		case "quit":
+			log.Println("Shutting down broker...")
+			b.Close()
+			return
+		default:
+			fmt.Println("Invalid command...")
+		}
+	}
+}
+
+// printHelp displays the available broker commands.
+func printHelp() {
+	fmt.Println("Possible commands:")
+	fmt.Println("* queues")
+	fmt.Println("* quit")
+	fmt.Println("* help")
+}
@@ -0,0 +1,136 @@
+// Command peril-schema writes machine-readable descriptions of every Peril
+// wire message: a JSON Schema of the payloads and an AsyncAPI-style document
+// of the exchanges, routing keys and content types they travel with.
+//
+// It also records a golden payload of every route at its current schema
+// version. Run with -check to verify that the committed schema files match the
+// Go types; it exits non-zero and names each file that is out of date. The
+// goldens are verified by the internal/routes tests.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/schema"
+)
+
+const (
+	// JSON Schema of every payload
+	messagesFile = "messages.schema.json"
+	// AsyncAPI-style document of every channel
+	asyncAPIFile = "peril.asyncapi.json"
+)
+
+// fileNames lists the generated files in the order they are reported.
+var fileNames = []string{asyncAPIFile, messagesFile}
+
+func main() {
+	outDir := flag.String("out", "schema", "directory the schema files are written to")
+	goldenDir := flag.String("golden", routes.GoldenDir, "directory golden payloads are recorded in")
+	check := flag.Bool("check", false, "compare the files in -out with the generated schema instead of writing them")
+	flag.Parse()
+
+	files, err := generate()
+	if err != nil {
+		log.Fatalf("could not generate schema: %v", err)
+	}
+
+	if *check {
+		stale := 0
+		for _, name := range fileNames {
+			path := filepath.Join(*outDir, name)
+			committed, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(committed, files[name]) {
+				fmt.Printf("%s is out of date\n", path)
+				stale++
+			}
+		}
+		if stale > 0 {
+			fmt.Println("run `go generate ./internal/routes` to regenerate")
+			os.Exit(1)
+		}
+		fmt.Println("schema is up to date")
+		return
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("could not create %s: %v", *outDir, err)
+	}
+	for _, name := range fileNames {
+		path := filepath.Join(*outDir, name)
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			log.Fatalf("could not write %s: %v", path, err)
+		}
+		fmt.Printf("wrote %s\n", path)
+	}
+
+	written, err := routes.WriteGoldens(*goldenDir)
+	for _, path := range written {
+		fmt.Printf("wrote %s\n", path)
+	}
+	if err != nil {
+		log.Fatalf("could not record golden payloads: %v", err)
+	}
+}
+
+// generate renders every schema file, keyed by file name.
+func generate() (map[string][]byte, error) {
+	// Locations and ranks are not enumerated: scenarios define their own
+	enums := map[reflect.Type][]any{
+		reflect.TypeFor[gamelogic.CombatKind]():    toAny(gamelogic.CombatKinds()),
+		reflect.TypeFor[gamelogic.Terrain]():       toAny(gamelogic.Terrains()),
+		reflect.TypeFor[gamelogic.TurnPhase]():     toAny(gamelogic.TurnPhases()),
+		reflect.TypeFor[gamelogic.VictoryReason](): toAny(gamelogic.VictoryReasons()),
+		reflect.TypeFor[routing.LobbyAction](): {
+			routing.LobbyCreate, routing.LobbyJoin, routing.LobbyLeave, routing.LobbyReady, routing.LobbyList,
+		},
+		reflect.TypeFor[routing.RoomState](): {routing.RoomOpen, routing.RoomStarted, routing.RoomFinished},
+		reflect.TypeFor[routing.PresenceKind](): {
+			routing.PresenceJoined, routing.PresenceLeft, routing.PresenceTimedOut,
+		},
+	}
+
+	messages := schema.NewJSONSchema(routes.All(), messagesFile, enums)
+	doc := schema.NewDocument(routes.All(), schema.Options{
+		Title:       "Peril",
+		Version:     "1.0.0",
+		Description: "Messages exchanged between Peril clients and servers through RabbitMQ.",
+		Exchanges: map[string]string{
+			routing.ExchangePerilDirect: "direct",
+			routing.ExchangePerilTopic:  "topic",
+		},
+		Enums: enums,
+		Parameters: map[string]string{
+			"username": "Username of the player the message concerns",
+			"game":     "ID of the game the message belongs to",
+		},
+	})
+
+	files := map[string][]byte{}
+	for name, v := range map[string]any{messagesFile: messages, asyncAPIFile: doc} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal %s: %w", name, err)
+		}
+		files[name] = append(data, '\n')
+	}
+	return files, nil
+}
+
+func toAny[T any](values []T) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
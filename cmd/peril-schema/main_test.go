@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSchemaUpToDate regenerates the schema in memory and compares it with
+// the files committed in schema/.
+func TestSchemaUpToDate(t *testing.T) {
+	files, err := generate()
+	if err != nil {
+		t.Fatalf("could not generate schema: %v", err)
+	}
+	for _, name := range fileNames {
+		path := filepath.Join("..", "..", "schema", name)
+		committed, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("could not read %s: %v", path, err)
+		}
+		if !bytes.Equal(committed, files[name]) {
+			t.Errorf("%s is out of date; run `go generate ./internal/routes`", path)
+		}
+	}
+}
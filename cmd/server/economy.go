@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/lobby"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/world"
+)
+
+// runTicks pays every game the income of its players' territories once a
+// tick, and then judges whether it has been won. Paused games are skipped,
+// and turn-based games are paid and judged when their turns are resolved
+// instead.
+func runTicks(wd *world.World, lb *lobby.Lobby, t pubsub.Transport, tick time.Duration, v world.Victory) {
+	for range time.Tick(tick) {
+		for _, game := range wd.Games() {
+			if wd.Paused(game) {
+				continue
+			}
+			ts, err := wd.PayIncome(game)
+			if err != nil {
+				fmt.Printf("error paying income in %s: %v\n> ", game, err)
+				continue
+			}
+			sendTreasuries(t, game, ts)
+			judge(t, wd, lb, game, v)
+		}
+	}
+}
+
+// sendTreasuries tells each player of a game their gold and income.
+func sendTreasuries(t pubsub.Transport, game string, ts []gamelogic.Treasury) {
+	for _, tr := range ts {
+		if err := pubsub.PublishRoute(t, routes.Treasuries, tr, game, tr.Username); err != nil {
+			fmt.Printf("error sending treasury to %s: %v\n", tr.Username, err)
+		}
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/lobby"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/world"
 )
 
 func handlerGameLogs() func(log routing.GameLog) pubsub.AckType {
@@ -20,3 +27,345 @@ func handlerGameLogs() func(log routing.GameLog) pubsub.AckType {
 		return pubsub.Ack
 	}
 }
+
+// handlerKeyRegistration records a player's public key and rebroadcasts the key directory.
+func handlerKeyRegistration(keys *pubsub.Keyring, t pubsub.Transport) func(routing.KeyRegistration) pubsub.AckType {
+	return func(reg routing.KeyRegistration) pubsub.AckType {
+		defer fmt.Printf("> ")
+
+		if err := routing.ValidateUsername(reg.Username); err != nil {
+			fmt.Printf("rejecting key registration: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		if err := gamelogic.VerifyRegistration(reg); err != nil {
+			fmt.Printf("rejecting key registration: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		if err := keys.Add(reg.Username, reg.PublicKey); err != nil {
+			fmt.Printf("rejecting key registration: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		if err := keys.AddEncryptionKey(reg.Username, reg.EncryptionKey); err != nil {
+			fmt.Printf("rejecting key registration: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		fmt.Printf("Registered public key for %s\n", reg.Username)
+
+		err := pubsub.PublishRoute(
+			t,
+			routes.KeyDirectory,
+			routing.KeyDirectory{
+				Keys:           keys.Export(),
+				EncryptionKeys: keys.ExportEncryptionKeys(),
+			},
+		)
+		if err != nil {
+			fmt.Printf("error publishing key directory: %v\n", err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+// handlerLobbyCommand applies a player's lobby request, answers it, and
+// starts the game when the request made everyone ready.
+func handlerLobbyCommand(lb *lobby.Lobby, start func(routing.GameRoom), t pubsub.Transport) func(routing.LobbyCommand) pubsub.AckType {
+	return func(cmd routing.LobbyCommand) pubsub.AckType {
+		defer fmt.Printf("> ")
+
+		reply := routing.LobbyReply{Username: cmd.Username, Action: cmd.Action, Game: cmd.Game}
+		var room routing.GameRoom
+		var started bool
+		var err error
+		switch cmd.Action {
+		case routing.LobbyCreate:
+			room, err = lb.Create(cmd.Username, cmd.Game, cmd.MaxPlayers)
+		case routing.LobbyJoin:
+			room, err = lb.Join(cmd.Username, cmd.Game)
+		case routing.LobbyLeave:
+			room, started, err = lb.Leave(cmd.Username)
+		case routing.LobbyReady:
+			room, started, err = lb.SetReady(cmd.Username, cmd.Ready)
+		case routing.LobbyList:
+			reply.Rooms = lb.Rooms()
+		default:
+			err = fmt.Errorf("unknown lobby action %q", cmd.Action)
+		}
+		if err != nil {
+			reply.Error = err.Error()
+		} else if room.ID != "" {
+			reply.Game = room.ID
+			fmt.Printf("%s: %s %s (%d/%d players)\n", cmd.Username, cmd.Action, room.ID, len(room.Players), room.MaxPlayers)
+		}
+
+		if err := pubsub.PublishRoute(t, routes.LobbyReplies, reply, cmd.Username); err != nil {
+			fmt.Printf("error publishing lobby reply: %v\n", err)
+			return pubsub.NackRequeue
+		}
+		if started {
+			start(room)
+		}
+		return pubsub.Ack
+	}
+}
+
+// startGame sets up the world of a room everyone is ready in and signals its
+// players that the game started.
+func startGame(room routing.GameRoom, wd *world.World, clocks *turnClocks, scenario *gamelogic.Scenario, combat gamelogic.Combat, t pubsub.Transport) {
+	fmt.Printf("Starting game %s with %v\n", room.ID, room.Players)
+	if err := wd.Start(room.ID, room.Players, scenario, combat, clocks.turnBased()); err != nil {
+		fmt.Printf("error: could not start game: %v\n", err)
+		return
+	}
+	start := routing.GameStart{Game: room.ID, Players: room.Players, StartedAt: time.Now()}
+	if err := pubsub.PublishRoute(t, routes.GameStarts, start, room.ID); err != nil {
+		fmt.Printf("error publishing game start: %v\n", err)
+	}
+	if ts, err := wd.Treasuries(room.ID); err == nil {
+		sendTreasuries(t, room.ID, ts)
+	}
+	if clocks.turnBased() {
+		clocks.start(room.ID)
+	}
+}
+
+// handlerHeartbeat records a player's heartbeat and announces them coming online or quitting.
+func handlerHeartbeat(table *presence.Table, lb *lobby.Lobby, start func(routing.GameRoom), t pubsub.Transport) func(routing.Heartbeat) pubsub.AckType {
+	return func(hb routing.Heartbeat) pubsub.AckType {
+		ev, changed := table.Beat(hb, time.Now())
+		if !changed {
+			return pubsub.Ack
+		}
+		defer fmt.Printf("> ")
+		if err := announcePresence(t, lb, start, ev); err != nil {
+			fmt.Printf("error: %v\n", err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+// expirePlayers announces the departure of players whose heartbeats stopped.
+func expirePlayers(table *presence.Table, lb *lobby.Lobby, start func(routing.GameRoom), t pubsub.Transport) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, ev := range table.Expire(now) {
+			if err := announcePresence(t, lb, start, ev); err != nil {
+				fmt.Printf("error: %v\n", err)
+			}
+			fmt.Printf("> ")
+		}
+	}
+}
+
+// announcePresence broadcasts a presence change. Players who went offline
+// give up their place in the lobby, which starts their room if everyone left
+// in it is ready.
+func announcePresence(t pubsub.Transport, lb *lobby.Lobby, start func(routing.GameRoom), ev routing.PresenceEvent) error {
+	fmt.Printf("%s %s\n", ev.Username, ev.Kind)
+	if !ev.Online() {
+		if room, started, err := lb.Leave(ev.Username); err == nil {
+			fmt.Printf("%s removed from game %s\n", ev.Username, room.ID)
+			if started {
+				start(room)
+			}
+		}
+	}
+	if err := pubsub.PublishRoute(t, routes.Presence, ev, ev.Username); err != nil {
+		return fmt.Errorf("could not publish presence of %s: %w", ev.Username, err)
+	}
+	return nil
+}
+
+// handlerWorldMove applies a player's move to the world, announces the wars
+// it starts, and corrects the player if the army they moved from is not the
+// one the world knows.
+func handlerWorldMove(wd *world.World, t pubsub.Transport) func(gamelogic.ArmyMove, map[string]string) pubsub.AckType {
+	return func(mv gamelogic.ArmyMove, params map[string]string) pubsub.AckType {
+		game := params["game"]
+		diffs, wars, err := wd.Move(game, mv)
+		if errors.Is(err, world.ErrIllegalMove) || errors.Is(err, world.ErrTurnBased) {
+			defer fmt.Printf("> ")
+			fmt.Printf("rejecting move of %s: %v\n", mv.Player.Username, err)
+			if err := sendWorld(t, wd, game, mv.Player.Username); err != nil {
+				fmt.Printf("error: %v\n", err)
+			}
+			return pubsub.NackDiscard
+		}
+		if err != nil {
+			defer fmt.Printf("> ")
+			fmt.Printf("rejecting move: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		if len(wars) == 0 && len(diffs) == 0 {
+			announceOwnership(t, wd, game)
+			return pubsub.Ack
+		}
+		defer fmt.Printf("> ")
+		for _, result := range wars {
+			announceWar(t, game, result)
+		}
+		announceOwnership(t, wd, game)
+		if len(diffs) == 0 {
+			return pubsub.Ack
+		}
+		fmt.Printf("%s is out of sync in %s:\n", mv.Player.Username, game)
+		for _, d := range diffs {
+			fmt.Printf("  * %s\n", d)
+		}
+		if err := sendWorld(t, wd, game, mv.Player.Username); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+		return pubsub.Ack
+	}
+}
+
+// handlerSpawn adds a player's new unit to the world.
+func handlerSpawn(wd *world.World, t pubsub.Transport) func(gamelogic.UnitSpawn, map[string]string) pubsub.AckType {
+	return func(spawn gamelogic.UnitSpawn, params map[string]string) pubsub.AckType {
+		game := params["game"]
+		err := wd.Spawn(game, spawn)
+		switch {
+		case errors.Is(err, world.ErrUnitExists), errors.Is(err, world.ErrNotOnMap), errors.Is(err, world.ErrTurnBased),
+			errors.Is(err, world.ErrNotHeld), errors.Is(err, world.ErrCannotAfford):
+			defer fmt.Printf("> ")
+			fmt.Printf("rejecting spawn: %v\n", err)
+			if err := sendWorld(t, wd, game, spawn.Username); err != nil {
+				fmt.Printf("error: %v\n", err)
+			}
+			return pubsub.NackDiscard
+		case err != nil:
+			defer fmt.Printf("> ")
+			fmt.Printf("rejecting spawn: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		announceOwnership(t, wd, game)
+		return pubsub.Ack
+	}
+}
+
+// handlerWar resolves a war a defender recognised from the world rather than
+// from the players' snapshots, and tells both sides the result. Wars are
+// fought when the move that starts them reaches the world, so a recognition
+// usually finds its war already fought, or not yet started if it overtook
+// the move, which fights it on arrival.
+func handlerWar(wd *world.World, t pubsub.Transport) func(gamelogic.RecognitionOfWar, map[string]string) pubsub.AckType {
+	return func(rw gamelogic.RecognitionOfWar, params map[string]string) pubsub.AckType {
+		game := params["game"]
+		result, fought, err := wd.War(game, rw.Attacker.Username, rw.Defender.Username)
+		if err != nil {
+			defer fmt.Printf("> ")
+			fmt.Printf("rejecting war: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		if !fought {
+			return pubsub.Ack
+		}
+
+		defer fmt.Printf("> ")
+		announceWar(t, game, result)
+		announceOwnership(t, wd, game)
+		return pubsub.Ack
+	}
+}
+
+// announceWar logs a war the server resolved and tells both sides the result.
+func announceWar(t pubsub.Transport, game string, result gamelogic.WarResult) {
+	message := fmt.Sprintf("A war between %s and %s resulted in a draw", result.Attacker, result.Defender)
+	if result.Winner != "" && len(result.Losers) > 0 {
+		message = fmt.Sprintf("%s won a war against %s", result.Winner, result.Losers[0])
+	}
+	fmt.Printf("%s: %s in %s\n", game, message, result.Location)
+	err := gamelogic.WriteLog(routing.GameLog{
+		CurrentTime: time.Now(),
+		Game:        game,
+		Message:     message,
+		Username:    routing.ServerIdentity,
+	})
+	if err != nil {
+		fmt.Printf("error writing log: %v\n", err)
+	}
+
+	// The world has already changed; a player who misses the result is
+	// corrected when they next move
+	for _, username := range []string{result.Attacker, result.Defender} {
+		if err := pubsub.PublishRoute(t, routes.WarResults, result, username, game); err != nil {
+			fmt.Printf("error publishing war result to %s: %v\n", username, err)
+		}
+	}
+}
+
+// announceOwnership tells every player of a game about the territories that
+// changed hands since it was last called.
+func announceOwnership(t pubsub.Transport, wd *world.World, game string) {
+	changes, err := wd.OwnershipChanges(game)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+	for _, ch := range changes {
+		if err := pubsub.PublishRoute(t, routes.Ownership, ch, game); err != nil {
+			fmt.Printf("error announcing owner of %s: %v\n", ch.Location, err)
+		}
+	}
+}
+
+// handlerOrders collects the orders a player sent at the end of a turn, to be
+// resolved with everyone else's.
+func handlerOrders(clocks *turnClocks) func(gamelogic.Orders, map[string]string) pubsub.AckType {
+	return func(o gamelogic.Orders, params map[string]string) pubsub.AckType {
+		if err := clocks.submit(params["game"], o); err != nil {
+			defer fmt.Printf("> ")
+			fmt.Printf("rejecting orders: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		return pubsub.Ack
+	}
+}
+
+// handlerLegacyWar discards a war declaration left in the shared war queue.
+func handlerLegacyWar() func(gamelogic.RecognitionOfWar) pubsub.AckType {
+	return func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+		defer fmt.Printf("> ")
+		fmt.Printf("Discarding war of %s on %s from the legacy %q queue\n",
+			rw.Attacker.Username, rw.Defender.Username, routing.LegacyWarQueue)
+		return pubsub.NackDiscard
+	}
+}
+
+// handlerWorldQuery answers a player's request for the state of a game.
+// Players of a game that has not started yet are sent its scenario.
+func handlerWorldQuery(wd *world.World, lb *lobby.Lobby, scenario *gamelogic.Scenario, t pubsub.Transport) func(routing.WorldQuery) pubsub.AckType {
+	return func(q routing.WorldQuery) pubsub.AckType {
+		room, ok := lb.Room(q.Game)
+		if ok && room.State == routing.RoomOpen && slices.Contains(room.Players, q.Username) {
+			ws := gamelogic.WorldState{Game: q.Game, Scenario: *scenario, AsOf: time.Now()}
+			if err := pubsub.PublishRoute(t, routes.WorldStates, ws, q.Game, q.Username); err != nil {
+				defer fmt.Printf("> ")
+				fmt.Printf("error: could not send scenario to %s: %v\n", q.Username, err)
+				return pubsub.NackDiscard
+			}
+			return pubsub.Ack
+		}
+		if err := sendWorld(t, wd, q.Game, q.Username); err != nil {
+			defer fmt.Printf("> ")
+			fmt.Printf("error: %v\n", err)
+			return pubsub.NackDiscard
+		}
+		return pubsub.Ack
+	}
+}
+
+// sendWorld publishes the state of game to one of its players, or why it
+// cannot be given.
+func sendWorld(t pubsub.Transport, wd *world.World, game, username string) error {
+	ws, err := wd.State(game, time.Now())
+	if err != nil {
+		ws = gamelogic.WorldState{Game: game, Error: err.Error()}
+	}
+	if err := pubsub.PublishRoute(t, routes.WorldStates, ws, game, username); err != nil {
+		return fmt.Errorf("could not send world state to %s: %w", username, err)
+	}
+	return nil
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
+	"time"
 
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/broker"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/lobby"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/world"
 )
 
 const (
@@ -15,29 +23,168 @@ const (
 )
 
 func main() {
+	embedded := flag.Bool("embedded", false, "host an in-process broker instead of connecting to RabbitMQ")
+	brokerAddr := flag.String("broker-addr", ":61613", "address the embedded broker accepts STOMP clients on")
+	scenarioPath := flag.String("scenario", "", "JSON file with the map and ruleset to play, e.g. scenarios/europe.json; the built-in world map by default")
+	tick := flag.Duration("tick", 10*time.Second, "how often territories pay income in real-time games")
+	winTerritories := flag.Int("win-territories", 0, "win by owning this many territories for -win-hold ticks or turns in a row; 0 to not win by territories")
+	winHold := flag.Int("win-hold", 3, "ticks or turns in a row a player must own -win-territories territories for")
+	timeLimit := flag.Duration("time-limit", 0, "end games after this long, won by the highest score; 0 for no limit")
+	combatKind := flag.String("combat", string(gamelogic.CombatPower), "how wars are decided: power, where the stronger side wins outright, or dice, fought in seeded rounds of rolls")
+	turnLength := flag.Duration("turn-length", 0, "play games in turns of this long, e.g. 30s, with every player's orders resolved together; real time by default")
+	flag.Parse()
+
+	scenario := gamelogic.DefaultScenario()
+	if *scenarioPath != "" {
+		loaded, err := gamelogic.LoadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatalf("could not load scenario: %v", err)
+		}
+		scenario = loaded
+	}
+	combat, err := gamelogic.CombatFor(gamelogic.CombatKind(*combatKind))
+	if err != nil {
+		log.Fatalf("could not choose combat: %v", err)
+	}
+
 	// Start server and connect to RabbitMQ
 	fmt.Println("Starting Peril server...")
 
-	conn, err := amqp.Dial(rmqServer)
+	var transport pubsub.Transport
+	if *embedded {
+		stompAddr, err := startEmbeddedBroker(*brokerAddr)
+		if err != nil {
+			log.Fatalf("could not start embedded broker: %v", err)
+		}
+		stompTransport, err := pubsub.DialStompTransport(stompAddr, pubsub.StompOptions{
+			HeartBeat: 10 * time.Second,
+			Receipts:  true,
+		})
+		if err != nil {
+			log.Fatalf("could not connect to embedded broker: %v", err)
+		}
+		transport = stompTransport
+		fmt.Printf("Peril game server hosting embedded broker on %s\n", stompAddr)
+	} else {
+		amqpTransport, err := pubsub.DialAMQP(rmqServer)
+		if err != nil {
+			log.Fatalf("could not connect to RabbitMQ server %s: %s", rmqServer, err)
+		}
+		transport = amqpTransport
+		fmt.Printf("Peril game server connected to RabbitMq server %s\n", rmqServer)
+	}
+	defer transport.Close()
+
+	// Sign everything the server publishes and only accept signed player messages
+	identity, err := gamelogic.LoadOrCreateIdentity(routing.ServerIdentity)
 	if err != nil {
-		log.Fatalf("could not connect to RabbitMQ server %s: %s", rmqServer, err)
+		log.Fatalf("could not load server key: %v", err)
+	}
+	// Players pin this key out of band before trusting anything the server sends
+	if path, err := identity.SavePublicKey(); err != nil {
+		log.Printf("could not save server public key: %v", err)
+	} else {
+		fmt.Printf("Server public key %s (saved to %s)\n", identity.PublicKeyString(), path)
 	}
-	defer conn.Close()
-	fmt.Printf("Peril game server connected to RabbitMq server %s\n", rmqServer)
+	keys := pubsub.NewKeyring()
+	keys.Add(identity.Username, identity.PublicKey)
+	signed := pubsub.NewSignedTransport(transport, identity.Username, identity.PrivateKey, keys)
 
-	// Create channel
-	pubCh, err := conn.Channel()
+	// Accept key registrations, which carry their own proof of possession
+	err = pubsub.SubscribeRoute(
+		transport,
+		routes.KeyRegistrations,
+		routing.KeysKey,
+		handlerKeyRegistration(keys, signed),
+	)
 	if err != nil {
-		log.Fatalf("could not create channel")
+		log.Fatalf("could not start consuming key registrations: %v", err)
 	}
 
-	// Bind to topic pause exchange
-	err = pubsub.SubscribeGob(
-		conn,
+	// Run the lobby players create, join and start games through. Lobby state
+	// lives in this process, so only one server should consume lobby commands.
+	lb := lobby.New()
+	wd := world.New()
+	// A closed room's game is over for good, whether or not it was finished
+	lb.Closed = func(id string) {
+		if err := wd.End(id); err == nil {
+			fmt.Printf("Game %s closed\n", id)
+		}
+	}
+	victory := world.Victory{Territories: *winTerritories, HoldFor: *winHold, TimeLimit: *timeLimit}
+	clocks := newTurnClocks(*turnLength, victory, wd, lb, signed)
+	start := func(room routing.GameRoom) {
+		startGame(room, wd, clocks, scenario, combat, signed)
+	}
+	err = pubsub.SubscribeRoute(
+		signed,
+		routes.LobbyCommands,
+		routing.LobbyCommandsKey,
+		handlerLobbyCommand(lb, start, signed),
+	)
+	if err != nil {
+		log.Fatalf("could not start consuming lobby commands: %v", err)
+	}
+
+	// Keep the authoritative state of every game from the players' moves and
+	// spawns, and resolve their wars. Like the lobby, it lives in this process.
+	err = pubsub.SubscribeRouteParams(signed, routes.ArmyMoves, routing.ArmyMovesPrefix, handlerWorldMove(wd, signed))
+	if err != nil {
+		log.Fatalf("could not start consuming army moves: %v", err)
+	}
+	err = pubsub.SubscribeRouteParams(signed, routes.Spawns, routing.SpawnsPrefix, handlerSpawn(wd, signed))
+	if err != nil {
+		log.Fatalf("could not start consuming spawns: %v", err)
+	}
+	err = pubsub.SubscribeRouteParams(signed, routes.WarRecognitions, routing.WarRecognitionsPrefix, handlerWar(wd, signed))
+	if err != nil {
+		log.Fatalf("could not start consuming war recognitions: %v", err)
+	}
+	err = pubsub.SubscribeRouteParams(signed, routes.Orders, routing.OrdersPrefix, handlerOrders(clocks))
+	if err != nil {
+		log.Fatalf("could not start consuming orders: %v", err)
+	}
+
+	// Empty the queue clients used to share for wars, which nothing publishes
+	// to anymore. Its declarations predate games, so there is nowhere to fight
+	// them; they are dead-lettered for the record.
+	err = pubsub.SubscribeJSON(
+		transport,
 		routing.ExchangePerilTopic,
-		routing.GameLogSlug,
-		routing.GameLogSlug+".*",
+		routing.LegacyWarQueue,
+		routing.WarPrefix+".*",
 		pubsub.SimpleQueueDurable,
+		handlerLegacyWar(),
+	)
+	if err != nil {
+		log.Fatalf("could not drain the legacy war queue: %v", err)
+	}
+	err = pubsub.SubscribeRoute(signed, routes.WorldQueries, routing.WorldQueryKey, handlerWorldQuery(wd, lb, scenario, signed))
+	if err != nil {
+		log.Fatalf("could not start consuming world queries: %v", err)
+	}
+
+	// Track who is online from their heartbeats
+	players := presence.NewTable()
+	err = pubsub.SubscribeRoute(
+		signed,
+		routes.Heartbeats,
+		routing.HeartbeatPrefix,
+		handlerHeartbeat(players, lb, start, signed),
+	)
+	if err != nil {
+		log.Fatalf("could not start consuming heartbeats: %v", err)
+	}
+	go expirePlayers(players, lb, start, signed)
+	if !clocks.turnBased() {
+		go runTicks(wd, lb, signed, *tick, victory)
+	}
+
+	// Consume the game logs of every game through one queue shared by all servers
+	err = pubsub.SubscribeRoute(
+		signed,
+		routes.GameLogs,
+		routing.GameLogSlug,
 		handlerGameLogs(),
 	)
 	if err != nil {
@@ -45,6 +192,12 @@ func main() {
 	}
 
 	// Start server REPL
+	fmt.Printf("Playing scenario %s: %d territories, %d kinds of unit\n",
+		scenario.Name, len(scenario.Map.Territories), len(scenario.Rules.Units))
+	fmt.Printf("Wars are decided by %s combat\n", combat.Kind())
+	if clocks.turnBased() {
+		fmt.Printf("Games are played in turns of %s\n", *turnLength)
+	}
 	gamelogic.PrintServerHelp()
 	for {
 		input := gamelogic.GetInput()
@@ -52,30 +205,73 @@ func main() {
 			continue
 		}
 		switch input[0] {
-		case "pause":
-			fmt.Println("Publishing paused game state...")
-			err = pubsub.PublishJSON(
-				pubCh,
-				routing.ExchangePerilDirect,
-				string(routing.PauseKey),
-				routing.PlayingState{IsPaused: true},
-			)
+		case "pause", "resume":
+			if len(input) < 2 {
+				fmt.Printf("usage: %s <game>\n", input[0])
+				continue
+			}
+			gameID := input[1]
+			if _, ok := lb.Room(gameID); !ok {
+				fmt.Printf("no such game: %s\n", gameID)
+				continue
+			}
+			paused := input[0] == "pause"
+			clocks.setPaused(gameID, paused)
+			if err := wd.SetPaused(gameID, paused); err != nil && !errors.Is(err, world.ErrNoGame) {
+				fmt.Printf("error: %v\n", err)
+			}
+			fmt.Printf("Publishing %s state to game %s...\n", input[0], gameID)
+			err = pubsub.PublishRoute(signed, routes.Pause, routing.PlayingState{IsPaused: paused}, gameID)
 			if err != nil {
 				log.Printf("could not publish time: %s", err)
+				continue
 			}
-			fmt.Println("Pause message sent!")
-		case "resume":
-			fmt.Println("Sending resume message...")
-			err = pubsub.PublishJSON(
-				pubCh,
-				routing.ExchangePerilDirect,
-				string(routing.PauseKey),
-				routing.PlayingState{IsPaused: false},
-			)
+			fmt.Println("Message sent!")
+		case "games":
+			rooms := lb.Rooms()
+			if len(rooms) == 0 {
+				fmt.Println("No games")
+			}
+			for _, room := range rooms {
+				fmt.Printf("%s [%s] host %s, %d/%d players: %v, ready: %v\n",
+					room.ID, room.State, room.Host, len(room.Players), room.MaxPlayers, room.Players, room.Ready)
+			}
+		case "players":
+			online := players.Online()
+			if len(online) == 0 {
+				fmt.Println("No players online")
+			}
+			now := time.Now()
+			for _, p := range online {
+				game := p.Game
+				if game == "" {
+					game = "lobby"
+				}
+				fmt.Printf("%s in %s, online for %s, last seen %s ago\n", p.Username, game,
+					now.Sub(p.FirstSeen).Round(time.Second), now.Sub(p.LastSeen).Round(time.Second))
+			}
+		case "world":
+			if len(input) < 2 {
+				games := wd.Games()
+				if len(games) == 0 {
+					fmt.Println("No games in play")
+				}
+				for _, game := range games {
+					ws, _ := wd.State(game, time.Now())
+					for _, p := range ws.Players {
+						fmt.Printf("%s: %s has %d unit(s)\n", game, p.Username, len(p.Units))
+					}
+				}
+				continue
+			}
+			ws, err := wd.State(input[1], time.Now())
 			if err != nil {
-				log.Printf("could not publish time: %s", err)
+				fmt.Println(err)
+				continue
 			}
-			fmt.Println("Resume message sent!")
+			gamelogic.PrintWorld(ws)
+		case "help":
+			gamelogic.PrintServerHelp()
 		case "quit":
 			log.Println("Exiting...")
 			return
@@ -84,3 +280,28 @@ func main() {
 		}
 	}
 }
+
+// startEmbeddedBroker serves a Peril broker on addr in the background and
+// returns the address the server itself should dial.
+func startEmbeddedBroker(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	b := broker.NewPeril()
+	b.HeartBeat = 10 * time.Second
+	go func() {
+		if err := b.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("embedded broker stopped: %v", err)
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/lobby"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/world"
+)
+
+// revealGrace is how long players have to send their orders once a turn ends.
+const revealGrace = 2 * time.Second
+
+// errOutOfTurn is returned for orders that do not belong to the turn being revealed.
+var errOutOfTurn = errors.New("orders are out of turn")
+
+// turnClocks runs the turns of every turn-based game the server started.
+type turnClocks struct {
+	length  time.Duration    // How long players have to give orders each turn; zero for real-time games
+	victory world.Victory    // How the games are won
+	wd      *world.World     // World the turns are resolved in
+	lb      *lobby.Lobby     // Lobby whose rooms the games are played in
+	t       pubsub.Transport // Transport the clocks publish on
+
+	mu     sync.Mutex
+	clocks map[string]*turnClock
+}
+
+// turnClock is the clock of one game.
+type turnClock struct {
+	game string
+
+	mu       sync.Mutex
+	turn     int                         // Number of the current turn
+	paused   bool                        // Whether the next turn waits for the game to resume
+	revealed []gamelogic.Orders          // Orders the previous turn carried out
+	orders   map[string]gamelogic.Orders // Orders sent for the turn being revealed, by username; nil outside the reveal
+}
+
+// newTurnClocks returns the clocks of games played in turns of length, or of
+// none if length is zero.
+func newTurnClocks(length time.Duration, v world.Victory, wd *world.World, lb *lobby.Lobby, t pubsub.Transport) *turnClocks {
+	return &turnClocks{length: length, victory: v, wd: wd, lb: lb, t: t, clocks: map[string]*turnClock{}}
+}
+
+// turnBased reports whether games are played in turns.
+func (cs *turnClocks) turnBased() bool {
+	return cs.length > 0
+}
+
+// start runs the turns of a game until it is won or its room is gone.
+func (cs *turnClocks) start(game string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, ok := cs.clocks[game]; ok {
+		return
+	}
+	c := &turnClock{game: game}
+	cs.clocks[game] = c
+	go func() {
+		cs.run(c)
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		delete(cs.clocks, game)
+	}()
+}
+
+// clock returns the clock of a game.
+func (cs *turnClocks) clock(game string) (*turnClock, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c, ok := cs.clocks[game]
+	return c, ok
+}
+
+// setPaused holds a game's next turn until it is resumed. The turn being
+// played is finished.
+func (cs *turnClocks) setPaused(game string, paused bool) {
+	if c, ok := cs.clock(game); ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.paused = paused
+	}
+}
+
+// submit records the orders a player sent for the turn being revealed.
+func (cs *turnClocks) submit(game string, o gamelogic.Orders) error {
+	c, ok := cs.clock(game)
+	if !ok {
+		return fmt.Errorf("%w: %s is not played in turns", errOutOfTurn, game)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.orders == nil || o.Turn != c.turn {
+		return fmt.Errorf("%w: %s sent orders for turn %d during turn %d", errOutOfTurn, o.Username, o.Turn, c.turn)
+	}
+	c.orders[o.Username] = o
+	return nil
+}
+
+// run plays turns of a game: players give orders for the turn's length, then
+// have revealGrace to send them, and then they are resolved together and the
+// game is judged.
+func (cs *turnClocks) run(c *turnClock) {
+	for {
+		for c.isPaused() {
+			time.Sleep(time.Second)
+		}
+		if _, ok := cs.lb.Room(c.game); !ok {
+			fmt.Printf("%s: no players left, stopping turns\n> ", c.game)
+			return
+		}
+
+		c.mu.Lock()
+		c.turn++
+		begin := gamelogic.TurnEvent{
+			Game:     c.game,
+			Turn:     c.turn,
+			Phase:    gamelogic.PhaseOrders,
+			EndsAt:   time.Now().Add(cs.length),
+			Revealed: c.revealed,
+		}
+		c.mu.Unlock()
+		if err := pubsub.PublishRoute(cs.t, routes.Turns, begin, c.game); err != nil {
+			fmt.Printf("error publishing start of turn %d of %s: %v\n> ", begin.Turn, c.game, err)
+		}
+		time.Sleep(cs.length)
+
+		c.mu.Lock()
+		c.orders = map[string]gamelogic.Orders{}
+		c.mu.Unlock()
+		reveal := gamelogic.TurnEvent{Game: c.game, Turn: begin.Turn, Phase: gamelogic.PhaseReveal}
+		if err := pubsub.PublishRoute(cs.t, routes.Turns, reveal, c.game); err != nil {
+			fmt.Printf("error publishing end of turn %d of %s: %v\n> ", begin.Turn, c.game, err)
+		}
+		time.Sleep(revealGrace)
+
+		c.mu.Lock()
+		var orders []gamelogic.Orders
+		for _, o := range c.orders {
+			orders = append(orders, o)
+		}
+		c.orders = nil
+		c.mu.Unlock()
+		report, err := cs.resolve(c.game, begin.Turn, orders)
+		if err != nil {
+			fmt.Printf("error resolving turn %d of %s: %v\n> ", begin.Turn, c.game, err)
+		}
+		c.mu.Lock()
+		c.revealed = report.Revealed
+		c.mu.Unlock()
+		if judge(cs.t, cs.wd, cs.lb, c.game, cs.victory) {
+			return
+		}
+	}
+}
+
+// resolve carries out a turn's orders, pays the players' income, and tells
+// them what happened: the wars they fought and the state of the world
+// afterwards, treasuries included.
+func (cs *turnClocks) resolve(game string, turn int, orders []gamelogic.Orders) (world.TurnReport, error) {
+	defer fmt.Printf("> ")
+	report, err := cs.wd.ResolveTurn(game, orders)
+	if err != nil {
+		return world.TurnReport{}, err
+	}
+	fmt.Printf("%s: resolved turn %d with orders from %d player(s)\n", game, turn, len(report.Revealed))
+	for _, r := range report.Rejected {
+		fmt.Printf("  * rejected %s\n", r)
+	}
+	for _, result := range report.Wars {
+		announceWar(cs.t, game, result)
+	}
+	announceOwnership(cs.t, cs.wd, game)
+	if _, err := cs.wd.PayIncome(game); err != nil {
+		return report, err
+	}
+	ws, err := cs.wd.State(game, time.Now())
+	if err != nil {
+		return report, err
+	}
+	for _, p := range ws.Players {
+		if err := pubsub.PublishRoute(cs.t, routes.WorldStates, ws, game, p.Username); err != nil {
+			fmt.Printf("error: could not send world state to %s: %v\n", p.Username, err)
+		}
+	}
+	return report, nil
+}
+
+// isPaused reports whether the game's next turn waits for it to resume.
+func (c *turnClock) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
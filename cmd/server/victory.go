@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/lobby"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routes"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/world"
+)
+
+// judge ends a game that has been won: it tells the players the final
+// standings, writes the result to the game log and marks the room finished.
+// It reports whether the game is over.
+func judge(t pubsub.Transport, wd *world.World, lb *lobby.Lobby, game string, v world.Victory) bool {
+	over, ended, err := wd.Judge(game, v, time.Now())
+	if err != nil {
+		fmt.Printf("error judging %s: %v\n> ", game, err)
+		return false
+	}
+	if !ended {
+		return false
+	}
+	defer fmt.Printf("> ")
+	fmt.Println()
+	gamelogic.PrintStandings(over)
+	if err := lb.Finish(game); err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+	if err := pubsub.PublishRoute(t, routes.GameOvers, over, game); err != nil {
+		fmt.Printf("error publishing the end of %s: %v\n", game, err)
+	}
+	err = gamelogic.WriteLog(routing.GameLog{
+		CurrentTime: over.EndedAt,
+		Game:        game,
+		Message:     over.Message(),
+		Username:    routing.ServerIdentity,
+	})
+	if err != nil {
+		fmt.Printf("error writing log: %v\n", err)
+	}
+	return true
+}
@@ -0,0 +1,388 @@
+// Package broker implements a small in-process message broker with the subset
+// of RabbitMQ semantics Peril relies on: direct, topic and fanout exchanges,
+// durable and transient queues, acknowledgements and dead-lettering. Clients
+// reach it over STOMP 1.2 using the same destinations as RabbitMQ's STOMP
+// plugin, so pubsub.StompTransport works against either.
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// ExchangeKind selects how an exchange routes messages to bound queues.
+type ExchangeKind string
+
+const (
+	// ExchangeDirect routes to queues bound with exactly the routing key
+	ExchangeDirect ExchangeKind = "direct"
+	// ExchangeTopic routes to queues whose binding pattern matches the routing key
+	ExchangeTopic ExchangeKind = "topic"
+	// ExchangeFanout routes to every bound queue regardless of routing key
+	ExchangeFanout ExchangeKind = "fanout"
+)
+
+var (
+	// ErrNoExchange is returned when publishing or binding to an undeclared exchange.
+	ErrNoExchange = errors.New("no such exchange")
+	// ErrNoQueue is returned when consuming or binding an undeclared queue.
+	ErrNoQueue = errors.New("no such queue")
+	// ErrQueueLocked is returned when another connection owns an exclusive queue.
+	ErrQueueLocked = errors.New("queue is exclusive to another connection")
+)
+
+// QueueOptions describes the lifecycle of a queue.
+type QueueOptions struct {
+	Durable            bool   // Queue outlives the connections that declared it
+	AutoDelete         bool   // Queue is deleted when its last consumer goes away
+	Exclusive          bool   // Queue belongs to the declaring connection
+	DeadLetterExchange string // Exchange rejected messages are republished to
+}
+
+// Message is a message as stored in a queue.
+type Message struct {
+	ID          string            // Broker-assigned message identifier
+	Exchange    string            // Exchange the message was published to
+	RoutingKey  string            // Routing key the message was published with
+	Headers     map[string]string // Content and application headers
+	Body        []byte            // Raw payload
+	Redelivered bool              // Whether the message was delivered before
+}
+
+// QueueInfo summarises the state of a queue.
+type QueueInfo struct {
+	Name      string       // Queue name
+	Options   QueueOptions // Queue lifecycle options
+	Ready     int          // Messages waiting for a consumer
+	Unacked   int          // Messages delivered but not yet settled
+	Consumers int          // Active consumers
+}
+
+// Broker holds exchanges and queues and serves them to STOMP clients.
+type Broker struct {
+	// HeartBeat is the heart-beat interval offered to clients. Zero disables heart-beats.
+	HeartBeat time.Duration
+	// Credentials restricts logins to the given login/passcode pairs when non-nil.
+	Credentials map[string]string
+
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+	nextID    uint64
+
+	listeners map[net.Listener]struct{}
+	sessions  map[*session]struct{}
+	closed    bool
+}
+
+type exchange struct {
+	name     string
+	kind     ExchangeKind
+	bindings []binding
+}
+
+type binding struct {
+	queue *queue
+	key   string
+}
+
+type queue struct {
+	name      string
+	opts      QueueOptions
+	owner     *session
+	ready     []Message
+	consumers []*consumer
+	next      int
+	unacked   int
+	hadUsers  bool
+}
+
+// consumer is a subscription of a session to a queue.
+type consumer struct {
+	id      string
+	session *session
+	queue   *queue
+	mode    pubsub.StompAckMode
+}
+
+// delivery is a message handed to a consumer awaiting acknowledgement.
+type delivery struct {
+	tag      uint64
+	consumer *consumer
+	msg      Message
+}
+
+// New creates an empty broker.
+func New() *Broker {
+	return &Broker{
+		exchanges: map[string]*exchange{},
+		queues:    map[string]*queue{},
+		listeners: map[net.Listener]struct{}{},
+		sessions:  map[*session]struct{}{},
+	}
+}
+
+// DeclareExchange creates an exchange, or checks that an existing one has the same kind.
+func (b *Broker) DeclareExchange(name string, kind ExchangeKind) error {
+	switch kind {
+	case ExchangeDirect, ExchangeTopic, ExchangeFanout:
+	default:
+		return fmt.Errorf("invalid exchange kind %q", kind)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return fmt.Errorf("exchange %s already declared as %s", name, ex.kind)
+		}
+		return nil
+	}
+	b.exchanges[name] = &exchange{name: name, kind: kind}
+	return nil
+}
+
+// DeclareQueue creates a queue that is not owned by any connection.
+func (b *Broker) DeclareQueue(name string, opts QueueOptions) error {
+	if opts.Exclusive {
+		return errors.New("exclusive queues can only be declared by a connection")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.declareQueue(name, opts, nil)
+	return err
+}
+
+// Bind routes messages published to exchange with a matching key into the queue.
+func (b *Broker) Bind(queueName, exchangeName, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bind(queueName, exchangeName, key)
+}
+
+// Publish routes a message through an exchange. The empty exchange name is
+// the default exchange, which delivers to the queue named by the routing key.
+func (b *Broker) Publish(exchangeName, key string, headers map[string]string, body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return b.publish(Message{
+		ID:         strconv.FormatUint(b.nextID, 10),
+		Exchange:   exchangeName,
+		RoutingKey: key,
+		Headers:    headers,
+		Body:       body,
+	})
+}
+
+// Queues returns a summary of every queue, sorted by name.
+func (b *Broker) Queues() []QueueInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	infos := make([]QueueInfo, 0, len(b.queues))
+	for _, q := range b.queues {
+		infos = append(infos, QueueInfo{
+			Name:      q.name,
+			Options:   q.opts,
+			Ready:     len(q.ready),
+			Unacked:   q.unacked,
+			Consumers: len(q.consumers),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// declareQueue creates a queue or returns the existing one. b.mu must be held.
+func (b *Broker) declareQueue(name string, opts QueueOptions, owner *session) (*queue, error) {
+	if q, ok := b.queues[name]; ok {
+		if q.owner != nil && q.owner != owner {
+			return nil, fmt.Errorf("%w: %s", ErrQueueLocked, name)
+		}
+		return q, nil
+	}
+	q := &queue{name: name, opts: opts}
+	if opts.Exclusive {
+		q.owner = owner
+	}
+	b.queues[name] = q
+	return q, nil
+}
+
+// bind adds a binding. b.mu must be held.
+func (b *Broker) bind(queueName, exchangeName, key string) error {
+	q, ok := b.queues[queueName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoQueue, queueName)
+	}
+	ex, ok := b.exchanges[exchangeName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoExchange, exchangeName)
+	}
+	for _, bd := range ex.bindings {
+		if bd.queue == q && bd.key == key {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, binding{queue: q, key: key})
+	return nil
+}
+
+// publish enqueues msg on every queue its exchange routes it to. b.mu must be held.
+func (b *Broker) publish(msg Message) error {
+	var targets []*queue
+	if msg.Exchange == "" {
+		if q, ok := b.queues[msg.RoutingKey]; ok {
+			targets = append(targets, q)
+		}
+	} else {
+		ex, ok := b.exchanges[msg.Exchange]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNoExchange, msg.Exchange)
+		}
+		seen := map[*queue]struct{}{}
+		for _, bd := range ex.bindings {
+			if _, ok := seen[bd.queue]; ok || !ex.matches(bd.key, msg.RoutingKey) {
+				continue
+			}
+			seen[bd.queue] = struct{}{}
+			targets = append(targets, bd.queue)
+		}
+	}
+
+	for _, q := range targets {
+		q.ready = append(q.ready, msg)
+		b.dispatch(q)
+	}
+	return nil
+}
+
+// matches reports whether a binding key selects a routing key on this exchange.
+func (ex *exchange) matches(bindingKey, routingKey string) bool {
+	switch ex.kind {
+	case ExchangeFanout:
+		return true
+	case ExchangeTopic:
+		return pubsub.TopicMatches(bindingKey, routingKey)
+	default:
+		return bindingKey == routingKey
+	}
+}
+
+// dispatch hands ready messages to consumers in round-robin order. b.mu must be held.
+func (b *Broker) dispatch(q *queue) {
+	for len(q.ready) > 0 && len(q.consumers) > 0 {
+		c := q.consumers[q.next%len(q.consumers)]
+		q.next++
+		msg := q.ready[0]
+		q.ready = q.ready[1:]
+
+		b.nextID++
+		d := &delivery{tag: b.nextID, consumer: c, msg: msg}
+		if c.mode != pubsub.StompAckAuto {
+			c.session.unacked[d.tag] = d
+			q.unacked++
+		}
+		c.session.deliver(d)
+	}
+}
+
+// settle removes an unacknowledged delivery and optionally requeues or dead-letters it.
+// b.mu must be held.
+func (b *Broker) settle(d *delivery, ack, requeue bool) {
+	s := d.consumer.session
+	if _, ok := s.unacked[d.tag]; !ok {
+		return
+	}
+	delete(s.unacked, d.tag)
+	q := d.consumer.queue
+	q.unacked--
+
+	switch {
+	case ack:
+	case requeue:
+		if _, live := b.queues[q.name]; !live {
+			return
+		}
+		d.msg.Redelivered = true
+		q.ready = append([]Message{d.msg}, q.ready...)
+		b.dispatch(q)
+	default:
+		b.deadLetter(q, d.msg, "rejected")
+	}
+}
+
+// deadLetter republishes a rejected message to the queue's dead letter exchange. b.mu must be held.
+func (b *Broker) deadLetter(q *queue, msg Message, reason string) {
+	if q.opts.DeadLetterExchange == "" {
+		return
+	}
+	headers := map[string]string{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers["x-death-reason"] = reason
+	headers["x-death-queue"] = q.name
+	headers["x-death-exchange"] = msg.Exchange
+
+	msg.Exchange = q.opts.DeadLetterExchange
+	msg.Headers = headers
+	msg.Redelivered = false
+	b.publish(msg)
+}
+
+// addConsumer attaches a consumer to a queue and starts dispatching to it. b.mu must be held.
+func (b *Broker) addConsumer(c *consumer) {
+	c.queue.consumers = append(c.queue.consumers, c)
+	c.queue.hadUsers = true
+	b.dispatch(c.queue)
+}
+
+// removeConsumer detaches a consumer, requeues what it had not settled and
+// deletes the queue if it was auto-delete and this was its last consumer.
+// b.mu must be held.
+func (b *Broker) removeConsumer(c *consumer) {
+	q := c.queue
+	for i, qc := range q.consumers {
+		if qc == c {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+
+	var pending []*delivery
+	for _, d := range c.session.unacked {
+		if d.consumer == c {
+			pending = append(pending, d)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].tag > pending[j].tag })
+	for _, d := range pending {
+		b.settle(d, false, true)
+	}
+
+	if q.opts.AutoDelete && q.hadUsers && len(q.consumers) == 0 {
+		b.deleteQueue(q)
+	}
+}
+
+// deleteQueue removes a queue and its bindings. b.mu must be held.
+func (b *Broker) deleteQueue(q *queue) {
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		kept := ex.bindings[:0]
+		for _, bd := range ex.bindings {
+			if bd.queue != q {
+				kept = append(kept, bd)
+			}
+		}
+		ex.bindings = kept
+	}
+}
@@ -0,0 +1,387 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// serve runs b on a loopback port until the test ends and returns its address.
+func serve(t *testing.T, b *Broker) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go b.Serve(ln)
+	t.Cleanup(func() { b.Close() })
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *pubsub.StompConn {
+	t.Helper()
+	conn, err := pubsub.DialStomp(addr, pubsub.StompOptions{Receipts: true})
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Disconnect() })
+	return conn
+}
+
+// subscribe consumes destination and returns the frames it receives.
+func subscribe(t *testing.T, conn *pubsub.StompConn, dest string, mode pubsub.StompAckMode, headers map[string]string) <-chan pubsub.Frame {
+	t.Helper()
+	got := make(chan pubsub.Frame, 16)
+	if _, err := conn.Subscribe(dest, mode, headers, func(f pubsub.Frame) { got <- f }); err != nil {
+		t.Fatalf("could not subscribe to %s: %v", dest, err)
+	}
+	return got
+}
+
+func receive(t *testing.T, ch <-chan pubsub.Frame) pubsub.Frame {
+	t.Helper()
+	select {
+	case f := <-ch:
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return pubsub.Frame{}
+	}
+}
+
+// queueInfo returns the summary of a queue, reporting false if it is gone.
+func queueInfo(b *Broker, name string) (QueueInfo, bool) {
+	for _, q := range b.Queues() {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return QueueInfo{}, false
+}
+
+// eventually fails the test unless cond holds within two seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExchangeRouting(t *testing.T) {
+	tests := []struct {
+		kind     ExchangeKind
+		bindings map[string]string // Binding key by queue
+		key      string
+		want     []string // Queues the message reaches
+	}{
+		{ExchangeDirect, map[string]string{"a": "pause", "b": "paused"}, "pause", []string{"a"}},
+		{ExchangeTopic, map[string]string{"a": "army_moves.*", "b": "army_moves.#", "c": "war.*"}, "army_moves.alice.friday", []string{"b"}},
+		{ExchangeTopic, map[string]string{"a": "army_moves.*", "b": "#"}, "army_moves.alice", []string{"a", "b"}},
+		{ExchangeFanout, map[string]string{"a": "", "b": "anything"}, "whatever", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		b := New()
+		if err := b.DeclareExchange("ex", tt.kind); err != nil {
+			t.Fatalf("could not declare %s exchange: %v", tt.kind, err)
+		}
+		for q, key := range tt.bindings {
+			b.DeclareQueue(q, QueueOptions{Durable: true})
+			if err := b.Bind(q, "ex", key); err != nil {
+				t.Fatalf("could not bind %s: %v", q, err)
+			}
+		}
+		if err := b.Publish("ex", tt.key, nil, []byte("hi")); err != nil {
+			t.Fatalf("could not publish: %v", err)
+		}
+		var reached []string
+		for _, q := range b.Queues() {
+			if q.Ready == 1 {
+				reached = append(reached, q.Name)
+			}
+		}
+		if strings.Join(reached, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s exchange routed %q to %v, want %v", tt.kind, tt.key, reached, tt.want)
+		}
+	}
+}
+
+func TestDeclarationErrors(t *testing.T) {
+	b := New()
+	b.DeclareExchange("ex", ExchangeDirect)
+	if err := b.DeclareExchange("ex", ExchangeTopic); err == nil {
+		t.Error("redeclaring an exchange as another kind succeeded")
+	}
+	if err := b.Publish("missing", "key", nil, nil); !errors.Is(err, ErrNoExchange) {
+		t.Errorf("publishing to a missing exchange returned %v, want %v", err, ErrNoExchange)
+	}
+	if err := b.Bind("missing", "ex", "key"); !errors.Is(err, ErrNoQueue) {
+		t.Errorf("binding a missing queue returned %v, want %v", err, ErrNoQueue)
+	}
+	if err := b.DeclareQueue("mine", QueueOptions{Exclusive: true}); err == nil {
+		t.Error("declaring an exclusive queue without a connection succeeded")
+	}
+
+	// The default exchange delivers to the queue named by the routing key
+	b.DeclareQueue("work", QueueOptions{Durable: true})
+	b.Publish("", "work", nil, []byte("job"))
+	if q, _ := queueInfo(b, "work"); q.Ready != 1 {
+		t.Errorf("work queue has %d ready messages, want 1", q.Ready)
+	}
+}
+
+func TestNackRequeuesAndRedelivers(t *testing.T) {
+	b := New()
+	b.DeclareQueue("work", QueueOptions{Durable: true})
+	conn := dial(t, serve(t, b))
+	got := subscribe(t, conn, "/amq/queue/work", pubsub.StompAckClientIndividual, nil)
+
+	b.Publish("", "work", nil, []byte("job"))
+	first := receive(t, got)
+	if first.Get("redelivered") != "" {
+		t.Error("first delivery is marked redelivered")
+	}
+	if err := conn.Nack(first, true); err != nil {
+		t.Fatalf("could not nack: %v", err)
+	}
+	again := receive(t, got)
+	if string(again.Body) != "job" || again.Get("redelivered") != "true" {
+		t.Errorf("redelivery is %q redelivered=%q, want the job marked redelivered", again.Body, again.Get("redelivered"))
+	}
+	if err := conn.Ack(again); err != nil {
+		t.Fatalf("could not ack: %v", err)
+	}
+	eventually(t, "the ack to settle", func() bool {
+		q, _ := queueInfo(b, "work")
+		return q.Ready == 0 && q.Unacked == 0
+	})
+}
+
+func TestUnackedMessagesRequeueInOrder(t *testing.T) {
+	b := New()
+	b.DeclareQueue("work", QueueOptions{Durable: true})
+	addr := serve(t, b)
+
+	first := dial(t, addr)
+	got := subscribe(t, first, "/amq/queue/work", pubsub.StompAckClientIndividual, nil)
+	for _, body := range []string{"1", "2", "3"} {
+		b.Publish("", "work", nil, []byte(body))
+	}
+	for range 3 {
+		receive(t, got)
+	}
+	// Leaving without acking hands every message back to the queue
+	if err := first.Disconnect(); err != nil {
+		t.Fatalf("could not disconnect: %v", err)
+	}
+	eventually(t, "the messages to be requeued", func() bool {
+		q, _ := queueInfo(b, "work")
+		return q.Ready == 3
+	})
+
+	second := dial(t, addr)
+	got = subscribe(t, second, "/amq/queue/work", pubsub.StompAckAuto, nil)
+	for _, want := range []string{"1", "2", "3"} {
+		f := receive(t, got)
+		if string(f.Body) != want || f.Get("redelivered") != "true" {
+			t.Errorf("got %q redelivered=%q, want %q redelivered", f.Body, f.Get("redelivered"), want)
+		}
+	}
+}
+
+func TestClientAckSettlesEarlierDeliveries(t *testing.T) {
+	b := New()
+	b.DeclareQueue("work", QueueOptions{Durable: true})
+	conn := dial(t, serve(t, b))
+	got := subscribe(t, conn, "/amq/queue/work", pubsub.StompAckClient, nil)
+	for _, body := range []string{"1", "2", "3"} {
+		b.Publish("", "work", nil, []byte(body))
+	}
+	receive(t, got)
+	second := receive(t, got)
+	receive(t, got)
+
+	if err := conn.Ack(second); err != nil {
+		t.Fatalf("could not ack: %v", err)
+	}
+	eventually(t, "the first two messages to settle", func() bool {
+		q, _ := queueInfo(b, "work")
+		return q.Unacked == 1
+	})
+}
+
+func TestRejectedMessagesAreDeadLettered(t *testing.T) {
+	b := NewPeril()
+	addr := serve(t, b)
+	transport := pubsub.NewStompTransport(dial(t, addr))
+
+	handled := make(chan struct{}, 1)
+	err := transport.Subscribe(routing.ExchangePerilTopic, "moves", "army_moves.*", pubsub.SimpleQueueDurable, func(pubsub.Message) pubsub.AckType {
+		handled <- struct{}{}
+		return pubsub.NackDiscard
+	})
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if err := transport.Publish(routing.ExchangePerilTopic, "army_moves.alice", pubsub.Message{Body: []byte("move")}); err != nil {
+		t.Fatalf("could not publish: %v", err)
+	}
+	<-handled
+
+	eventually(t, "the message to be dead-lettered", func() bool {
+		q, _ := queueInfo(b, DeadLetterQueue)
+		return q.Ready == 1
+	})
+	dead := receive(t, subscribe(t, dial(t, addr), "/amq/queue/"+DeadLetterQueue, pubsub.StompAckAuto, nil))
+	if string(dead.Body) != "move" {
+		t.Errorf("dead letter body = %q, want %q", dead.Body, "move")
+	}
+	for k, want := range map[string]string{
+		"x-death-reason":   "rejected",
+		"x-death-queue":    "moves",
+		"x-death-exchange": routing.ExchangePerilTopic,
+	} {
+		if got := dead.Get(k); got != want {
+			t.Errorf("dead letter %s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestRequeuedMessagesReachTransportAgain(t *testing.T) {
+	b := NewPeril()
+	transport := pubsub.NewStompTransport(dial(t, serve(t, b)))
+
+	deliveries := make(chan struct{}, 2)
+	err := transport.Subscribe(routing.ExchangePerilDirect, "pauses", routing.PauseKey, pubsub.SimpleQueueTransient, func(pubsub.Message) pubsub.AckType {
+		deliveries <- struct{}{}
+		if len(deliveries) == 1 {
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	})
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	transport.Publish(routing.ExchangePerilDirect, routing.PauseKey, pubsub.Message{Body: []byte("pause")})
+
+	eventually(t, "the requeued message to be handled again", func() bool { return len(deliveries) == 2 })
+	eventually(t, "the queue to settle", func() bool {
+		q, _ := queueInfo(b, "pauses")
+		return q.Ready == 0 && q.Unacked == 0
+	})
+	if q, _ := queueInfo(b, DeadLetterQueue); q.Ready != 0 {
+		t.Errorf("requeued message was dead-lettered")
+	}
+}
+
+func TestExclusiveQueuesBelongToTheirConnection(t *testing.T) {
+	b := NewPeril()
+	addr := serve(t, b)
+	owner := dial(t, addr)
+	headers := map[string]string{"x-queue-name": "mine", "exclusive": "true", "durable": "true", "auto-delete": "false"}
+	subscribe(t, owner, "/exchange/"+routing.ExchangePerilTopic+"/#", pubsub.StompAckAuto, headers)
+
+	other := dial(t, addr)
+	_, err := other.Subscribe("/exchange/"+routing.ExchangePerilTopic+"/#", pubsub.StompAckAuto, headers, func(pubsub.Frame) {})
+	if err == nil || !strings.Contains(err.Error(), ErrQueueLocked.Error()) {
+		t.Errorf("subscribing to another connection's exclusive queue returned %v, want %v", err, ErrQueueLocked)
+	}
+
+	// The queue goes with its owner, even though it is durable
+	owner.Disconnect()
+	eventually(t, "the exclusive queue to be deleted", func() bool {
+		_, ok := queueInfo(b, "mine")
+		return !ok
+	})
+}
+
+func TestAutoDeleteQueueGoesWithLastConsumer(t *testing.T) {
+	b := NewPeril()
+	conn := dial(t, serve(t, b))
+	headers := map[string]string{"x-queue-name": "shared", "durable": "false", "auto-delete": "true", "exclusive": "false"}
+	dest := "/exchange/" + routing.ExchangePerilTopic + "/war.*"
+
+	first, err := conn.Subscribe(dest, pubsub.StompAckAuto, headers, func(pubsub.Frame) {})
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	second, err := conn.Subscribe(dest, pubsub.StompAckAuto, headers, func(pubsub.Frame) {})
+	if err != nil {
+		t.Fatalf("could not subscribe again: %v", err)
+	}
+	if q, ok := queueInfo(b, "shared"); !ok || q.Consumers != 2 {
+		t.Fatalf("shared queue = %+v, want two consumers", q)
+	}
+
+	first.Unsubscribe()
+	if _, ok := queueInfo(b, "shared"); !ok {
+		t.Fatal("auto-delete queue was deleted while it still had a consumer")
+	}
+	second.Unsubscribe()
+	if _, ok := queueInfo(b, "shared"); ok {
+		t.Error("auto-delete queue outlived its last consumer")
+	}
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	b := New()
+	b.DeclareQueue("flood", QueueOptions{Durable: true})
+	conn, err := net.Dial("tcp", serve(t, b))
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Subscribe by hand, then never read another frame
+	for _, f := range []pubsub.Frame{
+		pubsub.NewFrame(pubsub.StompConnect, "accept-version", "1.2"),
+		pubsub.NewFrame(pubsub.StompSubscribe, "id", "0", "destination", "/amq/queue/flood", "receipt", "r"),
+	} {
+		if _, err := f.WriteTo(conn); err != nil {
+			t.Fatalf("could not write %s: %v", f.Command, err)
+		}
+	}
+	r := bufio.NewReader(conn)
+	for _, want := range []string{pubsub.StompConnected, pubsub.StompReceipt} {
+		if f, err := pubsub.ReadFrame(r); err != nil || f.Command != want {
+			t.Fatalf("read %s, %v, want %s", f.Command, err, want)
+		}
+	}
+
+	body := bytes.Repeat([]byte("x"), 32<<10)
+	for i := 0; i < 4*sessionQueueSize; i++ {
+		if q, _ := queueInfo(b, "flood"); q.Consumers == 0 {
+			break
+		}
+		b.Publish("", "flood", nil, body)
+	}
+	eventually(t, "the slow client to be disconnected", func() bool {
+		q, _ := queueInfo(b, "flood")
+		return q.Consumers == 0
+	})
+}
+
+func TestCredentials(t *testing.T) {
+	b := New()
+	b.Credentials = map[string]string{"peril": "secret"}
+	addr := serve(t, b)
+
+	if _, err := pubsub.DialStomp(addr, pubsub.StompOptions{Login: "peril", Passcode: "wrong"}); err == nil {
+		t.Error("connecting with the wrong passcode succeeded")
+	}
+	conn, err := pubsub.DialStomp(addr, pubsub.StompOptions{Login: "peril", Passcode: "secret"})
+	if err != nil {
+		t.Fatalf("could not connect with the right passcode: %v", err)
+	}
+	conn.Disconnect()
+}
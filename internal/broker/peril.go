@@ -0,0 +1,20 @@
+package broker
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// DeadLetterQueue collects every message rejected without requeueing.
+const DeadLetterQueue = "peril_dlq"
+
+// NewPeril creates a broker with the exchanges and dead letter queue a Peril game expects.
+func NewPeril() *Broker {
+	b := New()
+	b.DeclareExchange(routing.ExchangePerilDirect, ExchangeDirect)
+	b.DeclareExchange(routing.ExchangePerilTopic, ExchangeTopic)
+	b.DeclareExchange(pubsub.DeadLetterExchange, ExchangeFanout)
+	b.DeclareQueue(DeadLetterQueue, QueueOptions{Durable: true})
+	b.Bind(DeadLetterQueue, pubsub.DeadLetterExchange, "")
+	return b
+}
@@ -0,0 +1,489 @@
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// sessionQueueSize bounds the frames buffered for a client before it is
+// considered too slow and disconnected.
+const sessionQueueSize = 1024
+
+// session is one STOMP client connection.
+type session struct {
+	b    *Broker
+	conn net.Conn
+	out  chan pubsub.Frame
+	done chan struct{}
+
+	// flushed is closed when writeLoop exits
+	flushed chan struct{}
+
+	// guarded by b.mu
+	subs    map[string]*consumer
+	unacked map[uint64]*delivery
+	dead    bool
+}
+
+// ListenAndServe listens on the TCP address addr and serves STOMP clients.
+func (b *Broker) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return b.Serve(ln)
+}
+
+// Serve accepts STOMP connections on ln until the broker is closed.
+func (b *Broker) Serve(ln net.Listener) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	b.listeners[ln] = struct{}{}
+	b.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			b.mu.Lock()
+			delete(b.listeners, ln)
+			closed := b.closed
+			b.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+		go b.serveConn(conn)
+	}
+}
+
+// Close stops every listener and disconnects every client.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ln := range b.listeners {
+		ln.Close()
+	}
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+	return nil
+}
+
+// serveConn runs the STOMP protocol for a single client connection.
+func (b *Broker) serveConn(conn net.Conn) {
+	s := &session{
+		b:       b,
+		conn:    conn,
+		out:     make(chan pubsub.Frame, sessionQueueSize),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+		subs:    map[string]*consumer{},
+		unacked: map[uint64]*delivery{},
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		conn.Close()
+		return
+	}
+	b.sessions[s] = struct{}{}
+	b.mu.Unlock()
+	defer b.dropSession(s)
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	connect, err := readCommand(r)
+	if err != nil {
+		return
+	}
+	readTimeout, writeInterval, err := b.handshake(s, connect)
+	if err != nil {
+		s.writeNow(pubsub.NewFrame(pubsub.StompError, "message", err.Error()))
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	go s.writeLoop(writeInterval)
+
+	for {
+		if readTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
+		}
+		f, err := pubsub.ReadFrame(r)
+		if err != nil {
+			return
+		}
+		if f.Command == "" {
+			continue
+		}
+
+		err = b.handleFrame(s, f)
+		if err != nil {
+			s.send(pubsub.NewFrame(pubsub.StompError, "message", err.Error(), "receipt-id", f.Get("receipt")))
+			s.flushAndClose()
+			return
+		}
+		if id, ok := f.Lookup("receipt"); ok {
+			s.send(pubsub.NewFrame(pubsub.StompReceipt, "receipt-id", id))
+		}
+		if f.Command == pubsub.StompDisconnect {
+			s.flushAndClose()
+			return
+		}
+	}
+}
+
+// handshake validates CONNECT and answers with CONNECTED, returning the
+// negotiated read timeout and heart-beat send interval.
+func (b *Broker) handshake(s *session, f pubsub.Frame) (time.Duration, time.Duration, error) {
+	if f.Command != pubsub.StompConnect && f.Command != pubsub.StompStomp {
+		return 0, 0, fmt.Errorf("expected CONNECT, got %s", f.Command)
+	}
+	if !strings.Contains(f.Get("accept-version"), "1.2") {
+		return 0, 0, errors.New("only STOMP 1.2 is supported")
+	}
+	if b.Credentials != nil {
+		if pass, ok := b.Credentials[f.Get("login")]; !ok || pass != f.Get("passcode") {
+			return 0, 0, errors.New("access refused")
+		}
+	}
+
+	cx, cy := pubsub.ParseHeartBeat(f.Get("heart-beat"))
+	var readTimeout, writeInterval time.Duration
+	if cx > 0 && b.HeartBeat > 0 {
+		readTimeout = 2 * max(cx, b.HeartBeat)
+	}
+	if cy > 0 && b.HeartBeat > 0 {
+		writeInterval = max(cy, b.HeartBeat)
+	}
+
+	beat := strconv.FormatInt(b.HeartBeat.Milliseconds(), 10)
+	err := s.writeNow(pubsub.NewFrame(pubsub.StompConnected,
+		"version", "1.2",
+		"heart-beat", beat+","+beat,
+		"server", "peril-broker",
+	))
+	return readTimeout, writeInterval, err
+}
+
+// handleFrame applies a client frame to the broker.
+func (b *Broker) handleFrame(s *session, f pubsub.Frame) error {
+	switch f.Command {
+	case pubsub.StompSend:
+		return b.handleSend(f)
+	case pubsub.StompSubscribe:
+		return b.handleSubscribe(s, f)
+	case pubsub.StompUnsubscribe:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		c, ok := s.subs[f.Get("id")]
+		if !ok {
+			return fmt.Errorf("no subscription %q", f.Get("id"))
+		}
+		delete(s.subs, c.id)
+		b.removeConsumer(c)
+		return nil
+	case pubsub.StompAck, pubsub.StompNack:
+		return b.handleAck(s, f)
+	case pubsub.StompDisconnect:
+		return nil
+	default:
+		return fmt.Errorf("unsupported frame %s", f.Command)
+	}
+}
+
+func (b *Broker) handleSend(f pubsub.Frame) error {
+	exchangeName, key, err := parseSendDestination(f.Get("destination"))
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	for _, h := range f.Headers {
+		switch h[0] {
+		case "destination", "receipt", "content-length", "transaction":
+			continue
+		}
+		if _, ok := headers[h[0]]; !ok {
+			headers[h[0]] = h[1]
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if exchangeName == "" && strings.HasPrefix(f.Get("destination"), "/queue/") {
+		if _, err := b.declareQueue(key, QueueOptions{Durable: true}, nil); err != nil {
+			return err
+		}
+	}
+	b.nextID++
+	return b.publish(Message{
+		ID:         strconv.FormatUint(b.nextID, 10),
+		Exchange:   exchangeName,
+		RoutingKey: key,
+		Headers:    headers,
+		Body:       f.Body,
+	})
+}
+
+func (b *Broker) handleSubscribe(s *session, f pubsub.Frame) error {
+	id := f.Get("id")
+	dest := f.Get("destination")
+	if id == "" || dest == "" {
+		return errors.New("SUBSCRIBE requires id and destination headers")
+	}
+	mode := pubsub.StompAckMode(f.Get("ack"))
+	switch mode {
+	case "":
+		mode = pubsub.StompAckAuto
+	case pubsub.StompAckAuto, pubsub.StompAckClient, pubsub.StompAckClientIndividual:
+	default:
+		return fmt.Errorf("invalid ack mode %q", mode)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := s.subs[id]; ok {
+		return fmt.Errorf("duplicate subscription id %q", id)
+	}
+
+	var q *queue
+	var err error
+	switch {
+	case strings.HasPrefix(dest, "/exchange/"):
+		exchangeName, pattern, _ := strings.Cut(strings.TrimPrefix(dest, "/exchange/"), "/")
+		if _, ok := b.exchanges[exchangeName]; !ok {
+			return fmt.Errorf("%w: %s", ErrNoExchange, exchangeName)
+		}
+		name := f.Get("x-queue-name")
+		generated := name == ""
+		if generated {
+			b.nextID++
+			name = "stomp-subscription-" + strconv.FormatUint(b.nextID, 10)
+		}
+		durable := f.Get("durable") == "true"
+		opts := QueueOptions{
+			Durable:            durable,
+			AutoDelete:         headerBool(f, "auto-delete", !durable),
+			Exclusive:          headerBool(f, "exclusive", generated),
+			DeadLetterExchange: f.Get("x-dead-letter-exchange"),
+		}
+		if q, err = b.declareQueue(name, opts, s); err != nil {
+			return err
+		}
+		if err = b.bind(name, exchangeName, pattern); err != nil {
+			return err
+		}
+	case strings.HasPrefix(dest, "/queue/"):
+		opts := QueueOptions{Durable: true, DeadLetterExchange: f.Get("x-dead-letter-exchange")}
+		if q, err = b.declareQueue(strings.TrimPrefix(dest, "/queue/"), opts, s); err != nil {
+			return err
+		}
+	case strings.HasPrefix(dest, "/amq/queue/"):
+		name := strings.TrimPrefix(dest, "/amq/queue/")
+		existing, ok := b.queues[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNoQueue, name)
+		}
+		if existing.owner != nil && existing.owner != s {
+			return fmt.Errorf("%w: %s", ErrQueueLocked, name)
+		}
+		q = existing
+	default:
+		return fmt.Errorf("unsupported destination %q", dest)
+	}
+
+	c := &consumer{id: id, session: s, queue: q, mode: mode}
+	s.subs[id] = c
+	b.addConsumer(c)
+	return nil
+}
+
+func (b *Broker) handleAck(s *session, f pubsub.Frame) error {
+	tag, err := strconv.ParseUint(f.Get("id"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid ack id %q", f.Get("id"))
+	}
+	ack := f.Command == pubsub.StompAck
+	requeue := f.Get("requeue") != "false"
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, ok := s.unacked[tag]
+	if !ok {
+		return fmt.Errorf("unknown ack id %q", f.Get("id"))
+	}
+	if d.consumer.mode != pubsub.StompAckClient {
+		b.settle(d, ack, requeue)
+		return nil
+	}
+
+	// client mode settles every earlier delivery on the same subscription too
+	var covered []*delivery
+	for _, other := range s.unacked {
+		if other.consumer == d.consumer && other.tag <= tag {
+			covered = append(covered, other)
+		}
+	}
+	for _, other := range covered {
+		b.settle(other, ack, requeue)
+	}
+	return nil
+}
+
+// dropSession removes a disconnected client's consumers and exclusive queues.
+func (b *Broker) dropSession(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s.dead {
+		return
+	}
+	s.dead = true
+	close(s.done)
+	s.conn.Close()
+	delete(b.sessions, s)
+
+	for id, c := range s.subs {
+		delete(s.subs, id)
+		b.removeConsumer(c)
+	}
+	for _, q := range b.queues {
+		if q.owner == s {
+			b.deleteQueue(q)
+		}
+	}
+}
+
+// deliver queues a MESSAGE frame for the client. b.mu must be held.
+func (s *session) deliver(d *delivery) {
+	dest := "/queue/" + d.msg.RoutingKey
+	if d.msg.Exchange != "" {
+		dest = pubsub.ExchangeDestination(d.msg.Exchange, d.msg.RoutingKey)
+	}
+
+	f := pubsub.Frame{Command: pubsub.StompMessage, Body: d.msg.Body}
+	for k, v := range d.msg.Headers {
+		f.Set(k, v)
+	}
+	f.Set("destination", dest)
+	f.Set("message-id", d.msg.ID)
+	f.Set("subscription", d.consumer.id)
+	if d.consumer.mode != pubsub.StompAckAuto {
+		f.Set("ack", strconv.FormatUint(d.tag, 10))
+	}
+	if d.msg.Redelivered {
+		f.Set("redelivered", "true")
+	}
+	s.send(f)
+}
+
+// send queues a frame without blocking. A client that cannot keep up is disconnected.
+func (s *session) send(f pubsub.Frame) {
+	select {
+	case <-s.done:
+	case s.out <- f:
+	default:
+		log.Printf("peril-broker: disconnecting slow client %s", s.conn.RemoteAddr())
+		s.conn.Close()
+	}
+}
+
+// flushAndClose waits for queued frames to be written, then closes the connection.
+func (s *session) flushAndClose() {
+	s.send(pubsub.Frame{Command: "close"})
+	select {
+	case <-s.flushed:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// writeNow writes a frame synchronously, bypassing the outgoing queue.
+func (s *session) writeNow(f pubsub.Frame) error {
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	defer s.conn.SetWriteDeadline(time.Time{})
+	_, err := f.WriteTo(s.conn)
+	return err
+}
+
+// writeLoop writes queued frames and heart-beats until the session ends.
+func (s *session) writeLoop(heartBeat time.Duration) {
+	defer close(s.flushed)
+	w := bufio.NewWriter(s.conn)
+	var tick <-chan time.Time
+	if heartBeat > 0 {
+		ticker := time.NewTicker(heartBeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-s.done:
+			return
+		case f := <-s.out:
+			if f.Command == "close" {
+				s.conn.Close()
+				return
+			}
+			if _, err = f.WriteTo(w); err == nil {
+				err = w.Flush()
+			}
+		case <-tick:
+			if _, err = w.WriteString("\n"); err == nil {
+				err = w.Flush()
+			}
+		}
+		if err != nil {
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// readCommand reads frames until one that is not a heart-beat arrives.
+func readCommand(r *bufio.Reader) (pubsub.Frame, error) {
+	for {
+		f, err := pubsub.ReadFrame(r)
+		if err != nil || f.Command != "" {
+			return f, err
+		}
+	}
+}
+
+// parseSendDestination maps a SEND destination onto an exchange and routing key.
+func parseSendDestination(dest string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(dest, "/exchange/"):
+		exchangeName, key, _ := strings.Cut(strings.TrimPrefix(dest, "/exchange/"), "/")
+		return exchangeName, key, nil
+	case strings.HasPrefix(dest, "/queue/"):
+		return "", strings.TrimPrefix(dest, "/queue/"), nil
+	case strings.HasPrefix(dest, "/amq/queue/"):
+		return "", strings.TrimPrefix(dest, "/amq/queue/"), nil
+	default:
+		return "", "", fmt.Errorf("unsupported destination %q", dest)
+	}
+}
+
+// headerBool reads a boolean header, falling back to def when it is absent.
+func headerBool(f pubsub.Frame, key string, def bool) bool {
+	v, ok := f.Lookup(key)
+	if !ok {
+		return def
+	}
+	return v == "true"
+}
@@ -0,0 +1,178 @@
+package gamelogic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// CombatKind names a way of deciding wars.
+type CombatKind string
+
+const (
+	// CombatPower wars are won by the side with the greater strength, which
+	// loses nothing; the other side loses every unit, and a tie wipes out both
+	CombatPower CombatKind = "power"
+	// CombatDice wars are fought in rounds of dice rolls, each lost roll
+	// costing a hit point, until one side has no units left
+	CombatDice CombatKind = "dice"
+)
+
+// CombatKinds returns every way of deciding wars.
+func CombatKinds() []CombatKind {
+	return []CombatKind{CombatPower, CombatDice}
+}
+
+// Battle is a war about to be fought in one place.
+type Battle struct {
+	Scenario  *Scenario // Map and rules the war is fought under
+	Location  Location  // Where the war is fought
+	Attackers []Unit    // Units of the side that attacked, ordered by ID
+	Defenders []Unit    // Units of the side that was there first, ordered by ID
+}
+
+// Strengths returns the combined strength of each side of the battle.
+func (b Battle) Strengths() (attackers, defenders float64) {
+	for _, unit := range b.Attackers {
+		attackers += b.Scenario.Strength(unit, b.Defenders, b.Location, false)
+	}
+	for _, unit := range b.Defenders {
+		defenders += b.Scenario.Strength(unit, b.Attackers, b.Location, true)
+	}
+	return attackers, defenders
+}
+
+// Combat decides how badly the units of two players fighting in one place
+// are hurt.
+type Combat interface {
+	// Kind returns the name of the combat, for war results.
+	Kind() CombatKind
+	// Fight returns the hit points each attacking and defending unit lost,
+	// by ID; units missing were not hurt. The same battle and seed always
+	// give the same result, so anyone with both armies can replay a war.
+	Fight(b Battle, seed int64) (attackerHits, defenderHits map[int]int)
+}
+
+// CombatFor returns the combat of the given kind.
+func CombatFor(kind CombatKind) (Combat, error) {
+	switch kind {
+	case CombatPower:
+		return PowerCombat{}, nil
+	case CombatDice:
+		return DiceCombat{}, nil
+	default:
+		return nil, fmt.Errorf("unknown combat %q, want one of %v", kind, CombatKinds())
+	}
+}
+
+// PowerCombat is the original combat: the side with the greater strength
+// wins outright and the other loses every unit. Ties wipe out both sides. It
+// ignores the seed.
+type PowerCombat struct{}
+
+// Kind returns CombatPower.
+func (PowerCombat) Kind() CombatKind {
+	return CombatPower
+}
+
+// Fight kills every unit of the weaker side, or of both on a tie.
+func (PowerCombat) Fight(b Battle, _ int64) (map[int]int, map[int]int) {
+	attackerStrength, defenderStrength := b.Strengths()
+	attackerHits := map[int]int{}
+	defenderHits := map[int]int{}
+	if attackerStrength <= defenderStrength {
+		killAll(attackerHits, b.Attackers, &b.Scenario.Rules)
+	}
+	if defenderStrength <= attackerStrength {
+		killAll(defenderHits, b.Defenders, &b.Scenario.Rules)
+	}
+	return attackerHits, defenderHits
+}
+
+// DiceCombat is Risk-style combat. Each round every unit still standing
+// rolls a six-sided die for each point of its strength against the enemies
+// left and keeps the highest. The best attacking roll is matched against
+// the best defending roll, the second best against the second best, and so
+// on for as many pairs as the smaller side has units; the lower roll of
+// each pair loses, defenders winning ties, and that unit loses a hit point.
+// Units out of hit points die. Rounds go on until one side has no units
+// left, so the winner is usually hurt too.
+type DiceCombat struct{}
+
+// Kind returns CombatDice.
+func (DiceCombat) Kind() CombatKind {
+	return CombatDice
+}
+
+// Fight rolls rounds of dice seeded with seed until one side is wiped out.
+func (DiceCombat) Fight(b Battle, seed int64) (map[int]int, map[int]int) {
+	rng := rand.New(rand.NewSource(seed))
+	rules := &b.Scenario.Rules
+	attacking := sortedByID(b.Attackers)
+	defending := sortedByID(b.Defenders)
+	attackerHits := map[int]int{}
+	defenderHits := map[int]int{}
+	for len(attacking) > 0 && len(defending) > 0 {
+		a := rollFor(rng, attacking, defending, b, false)
+		d := rollFor(rng, defending, attacking, b, true)
+		for i := 0; i < len(a) && i < len(d); i++ {
+			if a[i].roll > d[i].roll {
+				defenderHits[d[i].unit.ID]++
+			} else {
+				attackerHits[a[i].unit.ID]++
+			}
+		}
+		attacking = survivors(attacking, attackerHits, rules)
+		defending = survivors(defending, defenderHits, rules)
+	}
+	return attackerHits, defenderHits
+}
+
+// roll is the best die a unit rolled in a round.
+type roll struct {
+	unit Unit
+	roll int
+}
+
+// rollFor rolls for every unit of a side, in order, and returns the rolls
+// best first. Equal rolls keep the units' order.
+func rollFor(rng *rand.Rand, units, enemies []Unit, b Battle, defending bool) []roll {
+	rolls := make([]roll, len(units))
+	for i, unit := range units {
+		best := 0
+		for range dice(b.Scenario.Strength(unit, enemies, b.Location, defending)) {
+			best = max(best, rng.Intn(6)+1)
+		}
+		rolls[i] = roll{unit: unit, roll: best}
+	}
+	sort.SliceStable(rolls, func(i, j int) bool { return rolls[i].roll > rolls[j].roll })
+	return rolls
+}
+
+// survivors returns the units that have hit points left after the hits
+// taken so far, in order.
+func survivors(units []Unit, hits map[int]int, rules *Ruleset) []Unit {
+	var alive []Unit
+	for _, unit := range units {
+		hurt := unit
+		hurt.Damage += hits[unit.ID]
+		if rules.HitPoints(hurt) > 0 {
+			alive = append(alive, unit)
+		}
+	}
+	return alive
+}
+
+// killAll records every unit taking the hit points it had left.
+func killAll(hits map[int]int, units []Unit, rules *Ruleset) {
+	for _, unit := range units {
+		hits[unit.ID] = rules.HitPoints(unit)
+	}
+}
+
+// sortedByID returns a copy of units ordered by ID.
+func sortedByID(units []Unit) []Unit {
+	sorted := append([]Unit(nil), units...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
@@ -0,0 +1,92 @@
+package gamelogic
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Treasury is a player's gold and what their territories earn them.
+type Treasury struct {
+	Username string // Player the treasury belongs to
+	Balance  int    // Gold the player can spend on units
+	Income   int    // Gold the player's territories pay each tick or turn
+}
+
+// Author returns the identity allowed to keep the players' accounts.
+func (Treasury) Author() string {
+	return routing.ServerIdentity
+}
+
+// GetTreasury returns the player's gold and income.
+func (gs *GameState) GetTreasury() Treasury {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Treasury
+}
+
+// SetTreasury replaces the player's gold and income, e.g. with the server's
+// account of them.
+func (gs *GameState) SetTreasury(t Treasury) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Treasury = t
+}
+
+// spend takes the cost of a unit from the player's gold, unless they can
+// not afford it.
+func (gs *GameState) spend(rank UnitRank, cost int) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if cost > gs.Treasury.Balance {
+		return fmt.Errorf("error: a(n) %s costs %d gold but you have %d", rank, cost, gs.Treasury.Balance)
+	}
+	gs.Treasury.Balance -= cost
+	return nil
+}
+
+// refund gives back gold spent on a unit that was not spawned after all.
+func (gs *GameState) refund(cost int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Treasury.Balance += cost
+}
+
+// canSpawnIn reports whether the player may spawn units in loc: territories
+// they own or have units in, or anywhere nobody owns to found their army if
+// they have neither units nor territories. The server also refuses
+// territories where other players have units.
+func (gs *GameState) canSpawnIn(loc Location) bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	username := gs.Player.Username
+	if gs.Owners[loc] == username {
+		return true
+	}
+	var spawning []Unit
+	if gs.Turn != nil {
+		spawning = gs.Turn.Orders.Spawns
+	}
+	for _, u := range gs.Player.Units {
+		if u.Location == loc {
+			return true
+		}
+	}
+	for _, u := range spawning {
+		if u.Location == loc {
+			return true
+		}
+	}
+	founding := len(gs.Player.Units) == 0 && len(spawning) == 0 && len(owned(gs.Owners, username)) == 0
+	return founding && gs.Owners[loc] == ""
+}
+
+// printTreasury describes the player's gold and income for the status command.
+func (gs *GameState) printTreasury() {
+	t := gs.GetTreasury()
+	per := "tick"
+	if gs.TurnBased() {
+		per = "turn"
+	}
+	fmt.Printf("You have %d gold and earn %d per %s.\n", t.Balance, t.Income, per)
+}
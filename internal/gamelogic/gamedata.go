@@ -2,6 +2,10 @@
 // It handles player management, unit spawning, movement, combat, and game state.
 package gamelogic
 
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
 // Player represents a game participant with their username and military units.
 type Player struct {
 	Username string
@@ -25,6 +29,8 @@ type Unit struct {
 	ID       int      // Unique identifier for the unit
 	Rank     UnitRank // Type/rank of the unit (infantry, cavalry, artillery)
 	Location Location // Current location of the unit on the map
+	Damage   int      // Hit points the unit has lost in wars
+	XP       int      // Wars the unit has survived
 }
 
 // ArmyMove represents a movement order containing the player, units being moved, and destination.
@@ -40,26 +46,45 @@ type RecognitionOfWar struct {
 	Defender Player // Player being attacked
 }
 
-// Location represents a geographic area on the game map.
-type Location string
+// UnitSpawn announces a unit a player has brought into the game.
+type UnitSpawn struct {
+	Username string // Player who owns the unit
+	Unit     Unit   // The new unit
+}
+
+// WarResult is the outcome of a war fought between two players.
+type WarResult struct {
+	Attacker   string            // Player who started the war
+	Defender   string            // Player who was attacked
+	Location   Location          // Where the war was fought
+	Winner     string            // Player who won the war, empty on a draw
+	Losers     []string          // Players who lost every unit they had in Location
+	Combat     CombatKind        // How the war was decided
+	Seed       int64             // Seed the war was fought with, to replay it
+	Casualties map[string][]int  // IDs of the units each side lost, by username
+	Survivors  map[string][]Unit // Units each side has left in Location, with their damage and experience, by username
+}
 
-// getAllRanks returns a set of all valid unit types in the game.
-func getAllRanks() map[UnitRank]struct{} {
-	return map[UnitRank]struct{}{
-		RankInfantry:  {},
-		RankCavalry:   {},
-		RankArtillery: {},
-	}
+// Author returns the player who published the move.
+func (mv ArmyMove) Author() string {
+	return mv.Player.Username
 }
 
-// getAllLocations returns a set of all valid geographic locations in the game.
-func getAllLocations() map[Location]struct{} {
-	return map[Location]struct{}{
-		"americas":   {},
-		"europe":     {},
-		"africa":     {},
-		"asia":       {},
-		"australia":  {},
-		"antarctica": {},
-	}
+// Author returns the player who published the war recognition. Recognitions
+// are raised by the defender when they see an attacker's move.
+func (rw RecognitionOfWar) Author() string {
+	return rw.Defender.Username
 }
+
+// Author returns the player who spawned the unit.
+func (s UnitSpawn) Author() string {
+	return s.Username
+}
+
+// Author returns the identity allowed to resolve wars.
+func (WarResult) Author() string {
+	return routing.ServerIdentity
+}
+
+// Location represents a geographic area on the game map.
+type Location string
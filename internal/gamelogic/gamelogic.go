@@ -7,18 +7,38 @@ import (
 	"math/rand"
 	"os"
 	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 // PrintClientHelp displays the available commands for the game client.
 func PrintClientHelp() {
 	fmt.Println("Possible commands:")
+	fmt.Println("* list")
+	fmt.Println("* create <game> [max players]")
+	fmt.Println("    example:")
+	fmt.Println("    create friday 4")
+	fmt.Println("* join <game>")
+	fmt.Println("    example:")
+	fmt.Println("    join friday")
+	fmt.Println("* ready")
+	fmt.Println("* unready")
+	fmt.Println("* leave")
 	fmt.Println("* move <location> <unitID> <unitID> <unitID>...")
 	fmt.Println("    example:")
 	fmt.Println("    move asia 1")
 	fmt.Println("* spawn <location> <rank>")
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
+	fmt.Println("* simulate <location> <unitID> <unitID> <unitID>...")
+	fmt.Println("    example:")
+	fmt.Println("    simulate asia 1 2")
 	fmt.Println("* status")
+	fmt.Println("* map")
+	fmt.Println("* world")
+	fmt.Println("* whisper <username> <message>")
+	fmt.Println("    example:")
+	fmt.Println("    whisper bob let's team up against alice")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -26,25 +46,36 @@ func PrintClientHelp() {
 	fmt.Println("* help")
 }
 
-// ClientWelcome greets the player and prompts for username input.
-func ClientWelcome() (string, error) {
+// ClientWelcome greets the player, prompts for username input and generates
+// the keypair the player's messages are signed with.
+func ClientWelcome() (Identity, error) {
 	fmt.Println("Welcome to the Peril client!")
 	fmt.Println("Please enter your username:")
 	words := GetInput()
 	if len(words) == 0 {
-		return "", errors.New("you must enter a username. goodbye")
+		return Identity{}, errors.New("you must enter a username. goodbye")
 	}
 	username := words[0]
+	if err := routing.ValidateUsername(username); err != nil {
+		return Identity{}, fmt.Errorf("%w. goodbye", err)
+	}
+	id, err := LoadOrCreateIdentity(username)
+	if err != nil {
+		return Identity{}, err
+	}
 	fmt.Printf("Welcome, %s!\n", username)
 	PrintClientHelp()
-	return username, nil
+	return id, nil
 }
 
 // PrintServerHelp displays the available commands for the game server.
 func PrintServerHelp() {
 	fmt.Println("Possible commands:")
-	fmt.Println("* pause")
-	fmt.Println("* resume")
+	fmt.Println("* games")
+	fmt.Println("* players")
+	fmt.Println("* world [game]")
+	fmt.Println("* pause <game>")
+	fmt.Println("* resume <game>")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
@@ -82,18 +113,31 @@ func PrintQuit() {
 	fmt.Println("I hate this game! (╯°□°)╯︵ ┻━┻")
 }
 
-// CommandStatus displays the current game state including pause status and player units.
+// CommandStatus displays the current game state including pause status and
+// player units with their health and veterancy.
 func (gs *GameState) CommandStatus() {
+	gs.mu.RLock()
+	over := gs.Over
+	gs.mu.RUnlock()
+	if over != nil {
+		fmt.Println("The game is over.")
+		PrintStandings(*over)
+		return
+	}
 	if gs.isPaused() {
 		fmt.Println("The game is paused.")
 		return
 	} else {
 		fmt.Println("The game is not paused.")
 	}
+	gs.printTurn()
+	gs.printTreasury()
+	gs.printOwned()
 
 	p := gs.GetPlayerSnap()
+	rules := &gs.GetScenario().Rules
 	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
 	for _, unit := range p.Units {
-		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+		fmt.Printf("* %v: %v, %v (%s)\n", unit.ID, unit.Location, unit.Rank, rules.describeUnit(unit))
 	}
 }
@@ -7,9 +7,15 @@ import (
 // GameState represents the current state of the game for a player.
 // It includes player information, pause status, and thread-safe access controls.
 type GameState struct {
-	Player Player        // Current player data
-	Paused bool          // Game pause state
-	mu     *sync.RWMutex // Mutex for thread-safe operations
+	Player   Player              // Current player data
+	Paused   bool                // Game pause state
+	Scenario *Scenario           // Map and rules the game is played with
+	Turn     *TurnState          // Current turn of a turn-based game, nil in real time
+	Treasury Treasury            // Gold the player has to spend on units
+	Owners   map[Location]string // Owner of every territory somebody owns
+	Over     *GameOver           // How the game ended, nil while it is played
+	LastID   int                 // Highest unit ID the player has used; IDs are never reused
+	mu       *sync.RWMutex       // Mutex for thread-safe operations
 }
 
 // NewGameState creates a new game state for the specified username.
@@ -19,8 +25,11 @@ func NewGameState(username string) *GameState {
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:   false,
+		Scenario: DefaultScenario(),
+		Treasury: Treasury{Username: username},
+		Owners:   map[Location]string{},
+		mu:       &sync.RWMutex{},
 	}
 }
 
@@ -63,6 +72,15 @@ func (gs *GameState) removeUnitsInLocation(loc Location) {
 	}
 }
 
+// removeUnits removes the units with the given IDs from the player's army.
+func (gs *GameState) removeUnits(ids []int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, id := range ids {
+		delete(gs.Player.Units, id)
+	}
+}
+
 // UpdateUnit updates an existing unit's information in the player's army.
 func (gs *GameState) UpdateUnit(u Unit) {
 	gs.mu.Lock()
@@ -70,6 +88,49 @@ func (gs *GameState) UpdateUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
+// ReplaceUnits replaces the player's whole army, e.g. with the server's
+// authoritative view of it. Unit IDs are never handed out again.
+func (gs *GameState) ReplaceUnits(units map[int]Unit) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Player.Units = map[int]Unit{}
+	for k, v := range units {
+		gs.Player.Units[k] = v
+		gs.LastID = max(gs.LastID, k)
+	}
+}
+
+// nextUnitID returns an ID for a new unit that the player has never used,
+// even for units that have since died.
+func (gs *GameState) nextUnitID() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.LastID++
+	return gs.LastID
+}
+
+// SkipUnitIDs makes sure no unit ID up to last is handed out, e.g. once the
+// server says the player has used them.
+func (gs *GameState) SkipUnitIDs(last int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.LastID = max(gs.LastID, last)
+}
+
+// GetScenario returns the map and rules the game is played with.
+func (gs *GameState) GetScenario() *Scenario {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Scenario
+}
+
+// SetScenario replaces the map and rules, e.g. with the ones the server plays.
+func (gs *GameState) SetScenario(s *Scenario) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Scenario = s
+}
+
 // GetUsername returns the current player's username.
 func (gs *GameState) GetUsername() string {
 	return gs.Player.Username
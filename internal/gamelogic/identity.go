@@ -0,0 +1,169 @@
+package gamelogic
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	// registrationContext domain-separates key registration proofs from message signatures
+	registrationContext = "peril-key-registration:"
+	// encryptionKeyContext derives the X25519 key from the signing key seed
+	encryptionKeyContext = "peril-x25519"
+)
+
+// Identity is a player's username together with the Ed25519 keypair that
+// signs their messages and the X25519 key sealed messages to them are opened with.
+type Identity struct {
+	Username      string             // Player username
+	PublicKey     ed25519.PublicKey  // Key registered with the server
+	PrivateKey    ed25519.PrivateKey // Key used to sign published messages
+	EncryptionKey *ecdh.PrivateKey   // Key used to open messages sealed for the player
+}
+
+// NewIdentity generates a fresh keypair for username.
+func NewIdentity(username string) (Identity, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return Identity{}, fmt.Errorf("could not generate key: %w", err)
+	}
+	return identityFromSeed(username, seed)
+}
+
+// identityFromSeed derives every key of an identity from a single Ed25519 seed.
+func identityFromSeed(username string, seed []byte) (Identity, error) {
+	priv := ed25519.NewKeyFromSeed(seed)
+	boxSeed := sha256.Sum256(append([]byte(encryptionKeyContext), seed...))
+	boxKey, err := ecdh.X25519().NewPrivateKey(boxSeed[:])
+	if err != nil {
+		return Identity{}, fmt.Errorf("could not derive encryption key: %w", err)
+	}
+	return Identity{
+		Username:      username,
+		PublicKey:     priv.Public().(ed25519.PublicKey),
+		PrivateKey:    priv,
+		EncryptionKey: boxKey,
+	}, nil
+}
+
+// LoadOrCreateIdentity returns the identity stored for username in the user's
+// config directory, generating and saving a new one on first use so the same
+// key is presented to the server across restarts.
+func LoadOrCreateIdentity(username string) (Identity, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return NewIdentity(username)
+	}
+	path := filepath.Join(dir, "peril", username+".key")
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return Identity{}, fmt.Errorf("corrupt key file %s", path)
+		}
+		return identityFromSeed(username, seed)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return Identity{}, fmt.Errorf("could not read key file: %w", err)
+	}
+
+	id, err := NewIdentity(username)
+	if err != nil {
+		return Identity{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return Identity{}, fmt.Errorf("could not create key directory: %w", err)
+	}
+	seed := base64.StdEncoding.EncodeToString(id.PrivateKey.Seed())
+	if err := os.WriteFile(path, []byte(seed+"\n"), 0o600); err != nil {
+		return Identity{}, fmt.Errorf("could not save key file: %w", err)
+	}
+	return id, nil
+}
+
+// PublicKeyString returns the public key base64-encoded, as players pin it.
+func (id Identity) PublicKeyString() string {
+	return base64.StdEncoding.EncodeToString(id.PublicKey)
+}
+
+// SavePublicKey writes the identity's public key to the user's config
+// directory, where clients on the same machine find it to pin, and returns
+// the file's path.
+func (id Identity) SavePublicKey() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find config directory: %w", err)
+	}
+	path := filepath.Join(dir, "peril", id.Username+".pub")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("could not create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(id.PublicKeyString()+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("could not save public key: %w", err)
+	}
+	return path, nil
+}
+
+// LoadPinnedKey returns the public key identity is pinned to: key itself when
+// set, otherwise the contents of file, otherwise the key SavePublicKey left
+// for identity in the user's config directory.
+func LoadPinnedKey(identity, key, file string) (ed25519.PublicKey, error) {
+	if key == "" {
+		if file == "" {
+			dir, err := os.UserConfigDir()
+			if err != nil {
+				return nil, fmt.Errorf("could not find config directory: %w", err)
+			}
+			file = filepath.Join(dir, "peril", identity+".pub")
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read public key of %s: %w", identity, err)
+		}
+		key = string(data)
+	}
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key for %s", identity)
+	}
+	return pub, nil
+}
+
+// Registration returns a key registration that proves possession of the private key.
+func (id Identity) Registration() routing.KeyRegistration {
+	reg := routing.KeyRegistration{
+		Username:      id.Username,
+		PublicKey:     id.PublicKey,
+		EncryptionKey: id.EncryptionKey.PublicKey().Bytes(),
+	}
+	reg.Proof = ed25519.Sign(id.PrivateKey, registrationPayload(reg))
+	return reg
+}
+
+// VerifyRegistration checks that a registration was made by the holder of its private key.
+func VerifyRegistration(reg routing.KeyRegistration) error {
+	if len(reg.PublicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid public key size")
+	}
+	if !ed25519.Verify(reg.PublicKey, registrationPayload(reg), reg.Proof) {
+		return fmt.Errorf("invalid registration proof for %s", reg.Username)
+	}
+	return nil
+}
+
+// registrationPayload is the data a registration proof signs.
+func registrationPayload(reg routing.KeyRegistration) []byte {
+	payload := []byte(registrationContext + reg.Username + ":")
+	return append(payload, reg.EncryptionKey...)
+}
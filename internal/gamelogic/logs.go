@@ -23,7 +23,7 @@ func WriteLog(gamelog routing.GameLog) error {
 	}
 	defer f.Close()
 
-	str := fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
+	str := fmt.Sprintf("%v [%v] %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Game, gamelog.Username, gamelog.Message)
 	_, err = f.WriteString(str)
 	if err != nil {
 		return fmt.Errorf("could not write to logs file: %v", err)
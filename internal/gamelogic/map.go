@@ -0,0 +1,152 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Terrain describes the ground of a territory.
+type Terrain string
+
+const (
+	// TerrainPlains is open ground
+	TerrainPlains Terrain = "plains"
+	// TerrainForest is wooded ground
+	TerrainForest Terrain = "forest"
+	// TerrainMountains is high, rough ground
+	TerrainMountains Terrain = "mountains"
+	// TerrainDesert is dry, open ground
+	TerrainDesert Terrain = "desert"
+	// TerrainTundra is frozen ground
+	TerrainTundra Terrain = "tundra"
+)
+
+// Terrains returns every kind of terrain.
+func Terrains() []Terrain {
+	return []Terrain{TerrainPlains, TerrainForest, TerrainMountains, TerrainDesert, TerrainTundra}
+}
+
+// Territory is a location on the map and the locations it borders.
+type Territory struct {
+	Name      Location   // Name units are spawned in and moved to by
+	Terrain   Terrain    // Ground of the territory
+	Neighbors []Location // Territories a unit can reach in one step
+	Income    int        // Gold the territory pays the player holding it each tick or turn
+}
+
+// Map is the board a game is played on: territories joined by the edges
+// units move along.
+type Map struct {
+	Name        string      // Name of the map
+	Territories []Territory // Every territory on the map
+}
+
+// DefaultMap returns the six-continent map Peril is played on unless a game
+// says otherwise.
+func DefaultMap() *Map {
+	return &Map{
+		Name: "world",
+		Territories: []Territory{
+			{Name: "americas", Terrain: TerrainPlains, Neighbors: []Location{"europe", "africa", "asia"}, Income: 3},
+			{Name: "europe", Terrain: TerrainForest, Neighbors: []Location{"americas", "africa", "asia"}, Income: 3},
+			{Name: "africa", Terrain: TerrainDesert, Neighbors: []Location{"americas", "europe", "asia", "antarctica"}, Income: 2},
+			{Name: "asia", Terrain: TerrainMountains, Neighbors: []Location{"americas", "europe", "africa", "australia"}, Income: 3},
+			{Name: "australia", Terrain: TerrainDesert, Neighbors: []Location{"asia", "antarctica"}, Income: 2},
+			{Name: "antarctica", Terrain: TerrainTundra, Neighbors: []Location{"africa", "australia"}, Income: 1},
+		},
+	}
+}
+
+// Territory returns the territory named loc.
+func (m *Map) Territory(loc Location) (Territory, bool) {
+	for _, t := range m.Territories {
+		if t.Name == loc {
+			return t, true
+		}
+	}
+	return Territory{}, false
+}
+
+// Has reports whether loc is a territory of the map.
+func (m *Map) Has(loc Location) bool {
+	_, ok := m.Territory(loc)
+	return ok
+}
+
+// Locations returns the name of every territory in alphabetical order.
+func (m *Map) Locations() []Location {
+	locations := make([]Location, 0, len(m.Territories))
+	for _, t := range m.Territories {
+		locations = append(locations, t.Name)
+	}
+	slices.Sort(locations)
+	return locations
+}
+
+// Adjacent reports whether an edge joins a and b. Edges go both ways, so it
+// is enough for either territory to list the other.
+func (m *Map) Adjacent(a, b Location) bool {
+	ta, okA := m.Territory(a)
+	tb, okB := m.Territory(b)
+	return okA && okB && (slices.Contains(ta.Neighbors, b) || slices.Contains(tb.Neighbors, a))
+}
+
+// Distance returns the fewest steps along edges from one territory to
+// another, or -1 if there is no path.
+func (m *Map) Distance(from, to Location) int {
+	if !m.Has(from) || !m.Has(to) {
+		return -1
+	}
+	steps := map[Location]int{from: 0}
+	queue := []Location{from}
+	for len(queue) > 0 {
+		loc := queue[0]
+		queue = queue[1:]
+		if loc == to {
+			return steps[loc]
+		}
+		for _, t := range m.Territories {
+			if _, seen := steps[t.Name]; !seen && m.Adjacent(loc, t.Name) {
+				steps[t.Name] = steps[loc] + 1
+				queue = append(queue, t.Name)
+			}
+		}
+	}
+	return -1
+}
+
+// CommandMap displays every territory, the territories it borders and the
+// player's units in it.
+func (gs *GameState) CommandMap() {
+	scenario := gs.GetScenario()
+	m := &scenario.Map
+	units := gs.getUnitsSnap()
+	fmt.Printf("==== Map: %s ====\n", m.Name)
+	for _, loc := range m.Locations() {
+		t, _ := m.Territory(loc)
+		var here []string
+		for _, u := range units {
+			if u.Location == loc {
+				here = append(here, fmt.Sprintf("%s %d", u.Rank, u.ID))
+			}
+		}
+		slices.Sort(here)
+
+		var borders []string
+		for _, other := range m.Locations() {
+			if m.Adjacent(loc, other) {
+				borders = append(borders, string(other))
+			}
+		}
+		fmt.Printf("%s (%s, %d gold)", t.Name, t.Terrain, t.Income)
+		if len(here) > 0 {
+			fmt.Printf(" [yours: %s]", strings.Join(here, ", "))
+		}
+		fmt.Println()
+		fmt.Printf("  └─ %s\n", strings.Join(borders, " · "))
+	}
+	for _, u := range scenario.Rules.Units {
+		fmt.Printf("* %s: power %d, moves %d, health %d, costs %d gold\n", u.Rank, u.Power, u.Moves, u.Health, u.Cost)
+	}
+}
@@ -0,0 +1,50 @@
+package gamelogic
+
+import "math"
+
+// Strength returns how strongly unit fights against enemies in a war in loc:
+// its power with its veterancy bonus, multiplied by its rank's matchup
+// against the enemies' ranks, by its rank's defence if it is defending, and
+// by the ruleset's modifier for the terrain of loc. Against a mixed army the
+// matchup is weighed by how many enemies are of each rank.
+func (s *Scenario) Strength(unit Unit, enemies []Unit, loc Location, defending bool) float64 {
+	strength := float64(s.Rules.UnitPower(unit))
+	ut, _ := s.Rules.Unit(unit.Rank)
+
+	if len(enemies) > 0 {
+		matchup := 0.0
+		for _, enemy := range enemies {
+			matchup += percent(ut.Matchups[enemy.Rank])
+		}
+		strength *= matchup / float64(len(enemies))
+	}
+
+	if defending {
+		strength *= percent(ut.Defence)
+	}
+
+	if t, ok := s.Map.Territory(loc); ok {
+		m := s.Rules.Terrain[t.Terrain]
+		if defending {
+			strength *= percent(m.Defence)
+		} else {
+			strength *= percent(m.Attack)
+		}
+	}
+	return strength
+}
+
+// percent returns p as a multiplier, taking zero, as for any modifier a
+// ruleset leaves out, to change nothing.
+func percent(p int) float64 {
+	if p == 0 {
+		return 1
+	}
+	return float64(p) / 100
+}
+
+// dice returns how many dice a unit of strength rolls: its strength rounded,
+// and at least one.
+func dice(strength float64) int {
+	return max(int(math.Round(strength)), 1)
+}
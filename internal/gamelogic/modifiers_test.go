@@ -0,0 +1,36 @@
+package gamelogic
+
+import "testing"
+
+func TestStrengthUsesRulesetModifiers(t *testing.T) {
+	s := DefaultScenario()
+	cavalry := Unit{ID: 1, Rank: RankCavalry}
+	infantry := Unit{ID: 2, Rank: RankInfantry}
+	artillery := Unit{ID: 3, Rank: RankArtillery}
+
+	tests := []struct {
+		name      string
+		unit      Unit
+		enemies   []Unit
+		loc       Location
+		defending bool
+		want      float64
+	}{
+		{"matchup", cavalry, []Unit{artillery}, "europe", false, 7.5},
+		{"mixed matchup", cavalry, []Unit{artillery, infantry}, "europe", false, 6.25},
+		{"defence", infantry, []Unit{cavalry}, "europe", true, 1.5},
+		{"mountains", artillery, []Unit{cavalry}, "asia", true, 15},
+		{"tundra", infantry, []Unit{cavalry}, "antarctica", true, 1.125},
+		{"tundra attack", artillery, []Unit{cavalry}, "antarctica", false, 5},
+	}
+	for _, tt := range tests {
+		if got := s.Strength(tt.unit, tt.enemies, tt.loc, tt.defending); got != tt.want {
+			t.Errorf("%s: strength = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	s.Rules.Units[1].Matchups = nil
+	if got := s.Strength(cavalry, []Unit{artillery}, "europe", false); got != 5 {
+		t.Errorf("strength without matchups = %v, want 5", got)
+	}
+}
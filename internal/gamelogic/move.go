@@ -55,17 +55,26 @@ func getOverlappingLocation(p1 Player, p2 Player) Location {
 	return ""
 }
 
-// CommandMove processes the move command from player input and creates an ArmyMove.
+// CommandMove processes the move command from player input and creates an
+// ArmyMove. In a turn-based game the move is only ordered, and made when the
+// turn ends.
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 	if gs.isPaused() {
 		return ArmyMove{}, errors.New("the game is paused, you can not move units")
 	}
+	if gs.IsOver() {
+		return ArmyMove{}, ErrGameOver
+	}
+	turnBased, err := gs.checkOrderPhase()
+	if err != nil {
+		return ArmyMove{}, err
+	}
 	if len(words) < 3 {
 		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
 	}
 	newLocation := Location(words[1])
-	locations := getAllLocations()
-	if _, ok := locations[newLocation]; !ok {
+	scenario := gs.GetScenario()
+	if !scenario.Map.Has(newLocation) {
 		return ArmyMove{}, fmt.Errorf("error: %s is not a valid location", newLocation)
 	}
 	unitIDs := []int{}
@@ -78,16 +87,29 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		unitIDs = append(unitIDs, unitID)
 	}
 
+	// Check every unit can make the move before moving any of them
 	newUnits := []Unit{}
 	for _, unitID := range unitIDs {
 		unit, ok := gs.GetUnit(unitID)
 		if !ok {
 			return ArmyMove{}, fmt.Errorf("error: unit with ID %v not found", unitID)
 		}
+		if err := scenario.CheckMove(unit, newLocation); err != nil {
+			return ArmyMove{}, err
+		}
 		unit.Location = newLocation
-		gs.UpdateUnit(unit)
 		newUnits = append(newUnits, unit)
 	}
+	if turnBased {
+		if err := gs.queueMove(MoveOrder{Units: unitIDs, ToLocation: newLocation}); err != nil {
+			return ArmyMove{}, err
+		}
+		fmt.Printf("Ordered %v units to move to %s at the end of the turn\n", len(newUnits), newLocation)
+		return ArmyMove{ToLocation: newLocation, Units: newUnits, Player: gs.GetPlayerSnap()}, nil
+	}
+	for _, unit := range newUnits {
+		gs.UpdateUnit(unit)
+	}
 
 	mv := ArmyMove{
 		ToLocation: newLocation,
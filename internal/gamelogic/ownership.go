@@ -0,0 +1,84 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// OwnershipChange announces a territory changing hands. A territory belongs
+// to the last player who had it to themselves, even once they leave it.
+type OwnershipChange struct {
+	Game     string   // Game the territory is in
+	Location Location // Territory that changed hands
+	Owner    string   // Player who owns the territory now
+	Previous string   // Player who owned it before, empty if nobody did
+}
+
+// Author returns the identity allowed to decide who owns what.
+func (OwnershipChange) Author() string {
+	return routing.ServerIdentity
+}
+
+// HandleOwnership records a territory changing hands.
+func (gs *GameState) HandleOwnership(ch OwnershipChange) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	username := gs.GetUsername()
+	switch {
+	case ch.Owner == username && ch.Previous == "":
+		fmt.Printf("==== You have claimed %s ====\n", ch.Location)
+	case ch.Owner == username:
+		fmt.Printf("==== You have taken %s from %s ====\n", ch.Location, ch.Previous)
+	case ch.Previous == username:
+		fmt.Printf("==== %s has taken %s from you ====\n", ch.Owner, ch.Location)
+	case ch.Previous == "":
+		fmt.Printf("==== %s has claimed %s ====\n", ch.Owner, ch.Location)
+	default:
+		fmt.Printf("==== %s has taken %s from %s ====\n", ch.Owner, ch.Location, ch.Previous)
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Owners[ch.Location] = ch.Owner
+}
+
+// SetOwners replaces who owns every territory, e.g. with the server's view.
+func (gs *GameState) SetOwners(owners map[Location]string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Owners = map[Location]string{}
+	for loc, owner := range owners {
+		gs.Owners[loc] = owner
+	}
+}
+
+// Owned returns the territories owned by username, sorted.
+func (gs *GameState) Owned(username string) []Location {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return owned(gs.Owners, username)
+}
+
+// owned returns the territories owned by username, sorted.
+func owned(owners map[Location]string, username string) []Location {
+	var locs []Location
+	for loc, owner := range owners {
+		if owner == username {
+			locs = append(locs, loc)
+		}
+	}
+	slices.Sort(locs)
+	return locs
+}
+
+// printOwned lists the player's territories for the status command.
+func (gs *GameState) printOwned() {
+	locs := gs.Owned(gs.GetUsername())
+	if len(locs) == 0 {
+		fmt.Println("You own no territories.")
+		return
+	}
+	fmt.Printf("You own %d territories: %v\n", len(locs), locs)
+}
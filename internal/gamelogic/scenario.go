@@ -0,0 +1,245 @@
+package gamelogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// UnitType is the ruleset's description of one rank of unit. Modifiers are
+// percentages of the unit's strength, zero or missing ones changing nothing.
+type UnitType struct {
+	Rank     UnitRank         // Name units of the type are spawned by
+	Power    int              // Strength the unit adds to its side in a war
+	Moves    int              // Borders the unit can cross in one move
+	Cost     int              // Gold it takes to spawn the unit
+	Health   int              // Hit points of a fresh unit
+	Defence  int              // Modifier of the unit's strength when defending a territory
+	Matchups map[UnitRank]int // Modifier of the unit's strength against enemies of each rank
+}
+
+// TerrainModifier is how fighting on a terrain changes the strength of each
+// side, in percent. Zero changes nothing.
+type TerrainModifier struct {
+	Attack  int // Modifier of the attackers' strength
+	Defence int // Modifier of the defenders' strength
+}
+
+// Ruleset lists the units a game can be played with.
+type Ruleset struct {
+	Name         string                      // Name of the ruleset
+	Units        []UnitType                  // Every rank of unit, weakest first
+	StartingGold int                         // Gold every player starts the game with
+	Terrain      map[Terrain]TerrainModifier // Modifiers of fighting on each terrain; terrains missing change nothing
+}
+
+// Scenario is everything a game is played with: the map and the rules.
+type Scenario struct {
+	Name  string  // Name of the scenario
+	Map   Map     // Board the game is played on
+	Rules Ruleset // Units the game is played with
+}
+
+// DefaultRuleset returns Peril's classic infantry, cavalry and artillery.
+func DefaultRuleset() Ruleset {
+	return Ruleset{
+		Name: "classic",
+		Units: []UnitType{
+			// Infantry digs in
+			{Rank: RankInfantry, Power: 1, Moves: 1, Cost: 1, Health: 1, Defence: 150},
+			// Cavalry rides down guns before they can be turned on it
+			{Rank: RankCavalry, Power: 5, Moves: 2, Cost: 4, Health: 2, Matchups: map[UnitRank]int{RankArtillery: 150}},
+			{Rank: RankArtillery, Power: 10, Moves: 1, Cost: 7, Health: 3},
+		},
+		StartingGold: 10,
+		Terrain: map[Terrain]TerrainModifier{
+			// Defenders hold the heights and the passes
+			TerrainMountains: {Attack: 100, Defence: 150},
+			// The cold wears down everyone, and attackers most of all
+			TerrainTundra: {Attack: 50, Defence: 75},
+		},
+	}
+}
+
+// DefaultScenario returns the scenario games are played with unless the
+// server loads another.
+func DefaultScenario() *Scenario {
+	return &Scenario{
+		Name:  "world",
+		Map:   *DefaultMap(),
+		Rules: DefaultRuleset(),
+	}
+}
+
+// LoadScenario reads a scenario from a JSON file and validates it.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read scenario: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var s Scenario
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("could not parse scenario %s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Validate checks that names are unique and well formed, that every border
+// leads to a territory and the map is connected, that units have positive
+// power, moves, cost and health, that modifiers are for known ranks and
+// terrains, and that no gold amount or modifier is negative.
+func (s *Scenario) Validate() error {
+	var errs []error
+	if s.Name == "" {
+		errs = append(errs, errors.New("scenario has no name"))
+	}
+
+	m := &s.Map
+	if len(m.Territories) == 0 {
+		errs = append(errs, errors.New("map has no territories"))
+	}
+	seen := map[Location]bool{}
+	for _, t := range m.Territories {
+		if err := validateName(string(t.Name)); err != nil {
+			errs = append(errs, fmt.Errorf("territory %q: %w", t.Name, err))
+		}
+		if seen[t.Name] {
+			errs = append(errs, fmt.Errorf("territory %q is defined twice", t.Name))
+		}
+		seen[t.Name] = true
+		if !slices.Contains(Terrains(), t.Terrain) {
+			errs = append(errs, fmt.Errorf("territory %q has unknown terrain %q", t.Name, t.Terrain))
+		}
+		if t.Income < 0 {
+			errs = append(errs, fmt.Errorf("territory %q must not have negative income", t.Name))
+		}
+	}
+	for _, t := range m.Territories {
+		for _, n := range t.Neighbors {
+			switch {
+			case n == t.Name:
+				errs = append(errs, fmt.Errorf("territory %q borders itself", t.Name))
+			case !seen[n]:
+				errs = append(errs, fmt.Errorf("territory %q borders unknown territory %q", t.Name, n))
+			}
+		}
+	}
+	if len(errs) == 0 && len(m.Territories) > 0 {
+		first := m.Territories[0].Name
+		for _, t := range m.Territories[1:] {
+			if m.Distance(first, t.Name) < 0 {
+				errs = append(errs, fmt.Errorf("map is not connected: %q can not be reached from %q", t.Name, first))
+			}
+		}
+	}
+
+	if len(s.Rules.Units) == 0 {
+		errs = append(errs, errors.New("ruleset has no units"))
+	}
+	ranks := map[UnitRank]bool{}
+	for _, u := range s.Rules.Units {
+		if err := validateName(string(u.Rank)); err != nil {
+			errs = append(errs, fmt.Errorf("unit %q: %w", u.Rank, err))
+		}
+		if ranks[u.Rank] {
+			errs = append(errs, fmt.Errorf("unit %q is defined twice", u.Rank))
+		}
+		ranks[u.Rank] = true
+		if u.Power <= 0 {
+			errs = append(errs, fmt.Errorf("unit %q must have positive power", u.Rank))
+		}
+		if u.Moves <= 0 {
+			errs = append(errs, fmt.Errorf("unit %q must have positive moves", u.Rank))
+		}
+		if u.Cost <= 0 {
+			errs = append(errs, fmt.Errorf("unit %q must have a positive cost", u.Rank))
+		}
+		if u.Health <= 0 {
+			errs = append(errs, fmt.Errorf("unit %q must have positive health", u.Rank))
+		}
+		if u.Defence < 0 {
+			errs = append(errs, fmt.Errorf("unit %q must not have a negative defence", u.Rank))
+		}
+	}
+	for _, u := range s.Rules.Units {
+		for rank, p := range u.Matchups {
+			if !ranks[rank] {
+				errs = append(errs, fmt.Errorf("unit %q has a matchup against unknown unit %q", u.Rank, rank))
+			}
+			if p < 0 {
+				errs = append(errs, fmt.Errorf("unit %q must not have a negative matchup against %q", u.Rank, rank))
+			}
+		}
+	}
+	for terrain, m := range s.Rules.Terrain {
+		if !slices.Contains(Terrains(), terrain) {
+			errs = append(errs, fmt.Errorf("ruleset has modifiers for unknown terrain %q", terrain))
+		}
+		if m.Attack < 0 || m.Defence < 0 {
+			errs = append(errs, fmt.Errorf("terrain %q must not have negative modifiers", terrain))
+		}
+	}
+	if s.Rules.StartingGold < 0 {
+		errs = append(errs, errors.New("ruleset must not have negative starting gold"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateName checks a territory or rank name can be typed as one word.
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	if strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return errors.New("name must be a single word")
+	}
+	return nil
+}
+
+// Unit returns the ruleset's description of rank.
+func (r *Ruleset) Unit(rank UnitRank) (UnitType, bool) {
+	for _, u := range r.Units {
+		if u.Rank == rank {
+			return u, true
+		}
+	}
+	return UnitType{}, false
+}
+
+// Power returns the combined power of units, veterancy included, which must
+// be of the ruleset's ranks.
+func (r *Ruleset) Power(units []Unit) int {
+	power := 0
+	for _, unit := range units {
+		power += r.UnitPower(unit)
+	}
+	return power
+}
+
+// CheckMove returns an error if the unit cannot reach to in one move.
+func (s *Scenario) CheckMove(u Unit, to Location) error {
+	if !s.Map.Has(to) {
+		return fmt.Errorf("error: %s is not a valid location", to)
+	}
+	ut, ok := s.Rules.Unit(u.Rank)
+	if !ok {
+		return fmt.Errorf("error: %s is not a valid unit", u.Rank)
+	}
+	dist := s.Map.Distance(u.Location, to)
+	switch {
+	case dist < 0:
+		return fmt.Errorf("error: unit %d can not reach %s from %s", u.ID, to, u.Location)
+	case dist > ut.Moves:
+		return fmt.Errorf("error: unit %d (%s) is %d steps from %s but moves at most %d", u.ID, u.Rank, dist, to, ut.Moves)
+	}
+	return nil
+}
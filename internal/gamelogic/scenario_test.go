@@ -0,0 +1,33 @@
+package gamelogic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWorldScenarioFileMatchesDefault(t *testing.T) {
+	s, err := LoadScenario("../../scenarios/world.json")
+	if err != nil {
+		t.Fatalf("could not load scenario: %v", err)
+	}
+	if want := DefaultScenario(); !reflect.DeepEqual(s.Rules, want.Rules) {
+		t.Errorf("scenarios/world.json rules = %+v, want the default %+v", s.Rules, want.Rules)
+	}
+}
+
+func TestScenarioFilesLoad(t *testing.T) {
+	for _, path := range []string{"../../scenarios/world.json", "../../scenarios/europe.json"} {
+		if _, err := LoadScenario(path); err != nil {
+			t.Errorf("could not load %s: %v", path, err)
+		}
+	}
+}
+
+func TestValidateRejectsUnknownModifiers(t *testing.T) {
+	s := DefaultScenario()
+	s.Rules.Units[0].Matchups = map[UnitRank]int{"dragon": 200}
+	s.Rules.Terrain = map[Terrain]TerrainModifier{"swamp": {Attack: 50}}
+	if err := s.Validate(); err == nil {
+		t.Error("scenario with modifiers for an unknown rank and terrain is valid")
+	}
+}
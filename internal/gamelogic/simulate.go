@@ -0,0 +1,120 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// simulations is how many wars the simulate command fights with dice to
+// predict their outcome.
+const simulations = 1000
+
+// CommandSimulate predicts the wars moving units into a location would
+// start, against each player ws has units there. The player's units already
+// there fight alongside the moved ones. Outcomes are predicted for both
+// kinds of combat: power once, and dice over many seeds.
+func (gs *GameState) CommandSimulate(words []string, ws WorldState) error {
+	if len(words) < 3 {
+		return errors.New("usage: simulate <location> <unitID> <unitID> <unitID> etc")
+	}
+	loc := Location(words[1])
+	scenario := gs.GetScenario()
+	if !scenario.Map.Has(loc) {
+		return fmt.Errorf("error: %s is not a valid location", loc)
+	}
+
+	me := gs.GetPlayerSnap()
+	moving := map[int]bool{}
+	var attackers []Unit
+	for _, word := range words[2:] {
+		id, err := strconv.Atoi(word)
+		if err != nil {
+			return fmt.Errorf("error: %s is not a valid unit ID", word)
+		}
+		unit, ok := me.Units[id]
+		if !ok {
+			return fmt.Errorf("error: unit with ID %v not found", id)
+		}
+		if moving[id] {
+			continue
+		}
+		if unit.Location != loc {
+			if err := scenario.CheckMove(unit, loc); err != nil {
+				return err
+			}
+		}
+		moving[id] = true
+		unit.Location = loc
+		attackers = append(attackers, unit)
+	}
+	for _, unit := range me.Units {
+		if unit.Location == loc && !moving[unit.ID] {
+			attackers = append(attackers, unit)
+		}
+	}
+	attackers = sortedByID(attackers)
+
+	t, _ := scenario.Map.Territory(loc)
+	fought := false
+	for _, p := range ws.Players {
+		if p.Username == me.Username {
+			continue
+		}
+		defenders := sortedByID(unitsIn(p, loc))
+		if len(defenders) == 0 {
+			continue
+		}
+		fought = true
+		b := Battle{Scenario: scenario, Location: loc, Attackers: attackers, Defenders: defenders}
+		fmt.Printf("Against %s's %d unit(s) in %s (%s):\n", p.Username, len(defenders), loc, t.Terrain)
+		printSimulation(b)
+	}
+	if !fought {
+		fmt.Printf("Nobody has units in %s; moving there starts no war.\n", loc)
+	}
+	return nil
+}
+
+// printSimulation predicts a battle's outcome for the simulate command.
+func printSimulation(b Battle) {
+	rules := &b.Scenario.Rules
+	attackerStrength, defenderStrength := b.Strengths()
+	fmt.Printf("* your strength %.1f against theirs %.1f\n", attackerStrength, defenderStrength)
+
+	switch {
+	case attackerStrength > defenderStrength:
+		fmt.Println("* power combat: you would win without losses")
+	case attackerStrength < defenderStrength:
+		fmt.Println("* power combat: you would lose every unit")
+	default:
+		fmt.Println("* power combat: a draw, both sides wiped out")
+	}
+
+	wins, lost, killed := 0, 0, 0
+	for seed := range int64(simulations) {
+		attackerHits, defenderHits := DiceCombat{}.Fight(b, seed)
+		dead := casualties(b.Attackers, attackerHits, rules)
+		lost += dead
+		killed += casualties(b.Defenders, defenderHits, rules)
+		if dead < len(b.Attackers) {
+			wins++
+		}
+	}
+	fmt.Printf("* dice combat: you would win %d%% of wars, losing %.1f of %d unit(s) and killing %.1f of %d on average\n",
+		wins*100/simulations,
+		float64(lost)/simulations, len(b.Attackers),
+		float64(killed)/simulations, len(b.Defenders))
+}
+
+// casualties counts the units killed by hits.
+func casualties(units []Unit, hits map[int]int, rules *Ruleset) int {
+	dead := 0
+	for _, unit := range units {
+		unit.Damage += hits[unit.ID]
+		if rules.HitPoints(unit) == 0 {
+			dead++
+		}
+	}
+	return dead
+}
@@ -6,30 +6,56 @@ import (
 )
 
 // CommandSpawn processes the spawn command to create new military units.
-func (gs *GameState) CommandSpawn(words []string) error {
+// It returns the spawn so that it can be announced to the server. Units get
+// IDs the player has never used. In a turn-based game the unit is only
+// ordered, and spawns when the turn ends with an ID the server assigns.
+func (gs *GameState) CommandSpawn(words []string) (UnitSpawn, error) {
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return UnitSpawn{}, errors.New("usage: spawn <location> <rank>")
+	}
+	if gs.IsOver() {
+		return UnitSpawn{}, ErrGameOver
+	}
+	turnBased, err := gs.checkOrderPhase()
+	if err != nil {
+		return UnitSpawn{}, err
 	}
 
+	scenario := gs.GetScenario()
 	locationName := words[1]
-	locations := getAllLocations()
-	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+	if !scenario.Map.Has(Location(locationName)) {
+		return UnitSpawn{}, fmt.Errorf("error: %s is not a valid location", locationName)
+	}
+
+	if !gs.canSpawnIn(Location(locationName)) {
+		return UnitSpawn{}, fmt.Errorf("error: you can only spawn units in territories you hold, and %s is not one", locationName)
 	}
 
 	rank := words[2]
-	units := getAllRanks()
-	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+	ut, ok := scenario.Rules.Unit(UnitRank(rank))
+	if !ok {
+		return UnitSpawn{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
+	if err := gs.spend(ut.Rank, ut.Cost); err != nil {
+		return UnitSpawn{}, err
+	}
+	id := gs.nextUnitID()
+	unit := Unit{
 		ID:       id,
 		Rank:     UnitRank(rank),
 		Location: Location(locationName),
-	})
+	}
+	if turnBased {
+		if err := gs.queueSpawn(unit); err != nil {
+			gs.refund(ut.Cost)
+			return UnitSpawn{}, err
+		}
+		fmt.Printf("Ordered a(n) %s to spawn in %s at the end of the turn, when the server gives it an id\n", rank, locationName)
+		return UnitSpawn{Username: gs.GetUsername(), Unit: unit}, nil
+	}
+	gs.addUnit(unit)
 
 	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	return UnitSpawn{Username: gs.GetUsername(), Unit: unit}, nil
 }
@@ -0,0 +1,56 @@
+package gamelogic
+
+import "testing"
+
+func newTestState(t *testing.T) *GameState {
+	t.Helper()
+	gs := NewGameState("alice")
+	gs.SetTreasury(Treasury{Username: "alice", Balance: 20})
+	return gs
+}
+
+func TestSpawnAfterLosingWarUsesNewID(t *testing.T) {
+	gs := newTestState(t)
+	first, err := gs.CommandSpawn([]string{"spawn", "europe", "infantry"})
+	if err != nil {
+		t.Fatalf("could not spawn: %v", err)
+	}
+
+	gs.HandleWarResult(WarResult{
+		Attacker:   "alice",
+		Defender:   "bob",
+		Location:   "europe",
+		Winner:     "bob",
+		Losers:     []string{"alice"},
+		Casualties: map[string][]int{"alice": {first.Unit.ID}},
+	})
+	if n := len(gs.GetPlayerSnap().Units); n != 0 {
+		t.Fatalf("alice has %d units after losing them all", n)
+	}
+
+	again, err := gs.CommandSpawn([]string{"spawn", "europe", "infantry"})
+	if err != nil {
+		t.Fatalf("could not spawn again: %v", err)
+	}
+	if again.Unit.ID <= first.Unit.ID {
+		t.Errorf("respawned unit got ID %d, want one above %d", again.Unit.ID, first.Unit.ID)
+	}
+}
+
+func TestSpawnAfterServerAssignedIDs(t *testing.T) {
+	gs := newTestState(t)
+	gs.HandleTurn(TurnEvent{Turn: 1, Phase: PhaseOrders})
+	if _, err := gs.CommandSpawn([]string{"spawn", "europe", "infantry"}); err != nil {
+		t.Fatalf("could not order a spawn: %v", err)
+	}
+
+	// The server spawned the unit with an ID of its own, and it then died,
+	// so the world state only says the ID was used
+	const assigned = 7
+	gs.SkipUnitIDs(assigned)
+	gs.ReplaceUnits(map[int]Unit{})
+
+	if id := gs.nextUnitID(); id <= assigned {
+		t.Errorf("next unit ID = %d, want one above the server's %d", id, assigned)
+	}
+}
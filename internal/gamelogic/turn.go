@@ -0,0 +1,187 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// TurnPhase is the part of a turn a turn-based game is in.
+type TurnPhase string
+
+const (
+	// PhaseOrders is when players give orders, which stay hidden until the turn ends
+	PhaseOrders TurnPhase = "orders"
+	// PhaseReveal is when the turn has ended and its orders are sent to the server
+	PhaseReveal TurnPhase = "reveal"
+)
+
+// TurnPhases returns every phase of a turn.
+func TurnPhases() []TurnPhase {
+	return []TurnPhase{PhaseOrders, PhaseReveal}
+}
+
+// MoveOrder is a move given during a turn, made when the turn ends.
+type MoveOrder struct {
+	Units      []int    // IDs of the units to move
+	ToLocation Location // Destination of the units
+}
+
+// Orders are everything a player ordered during one turn.
+type Orders struct {
+	Username string      // Player who gave the orders
+	Turn     int         // Turn the orders were given in
+	Spawns   []Unit      // Units to bring into the game
+	Moves    []MoveOrder // Moves of units the player had when the turn started
+}
+
+// Author returns the player who gave the orders.
+func (o Orders) Author() string {
+	return o.Username
+}
+
+// TurnEvent is a tick of the server's clock in a turn-based game: the start
+// of a turn, when players give orders, or its end, when they are revealed.
+type TurnEvent struct {
+	Game     string    // Game the turn is played in
+	Turn     int       // Number of the turn, from 1
+	Phase    TurnPhase // What the turn has come to
+	EndsAt   time.Time // When the order phase ends; zero at the reveal
+	Revealed []Orders  // At the start of a turn, the orders the previous one carried out
+}
+
+// Author returns the identity allowed to run the clock.
+func (TurnEvent) Author() string {
+	return routing.ServerIdentity
+}
+
+// TurnState is the player's view of the current turn.
+type TurnState struct {
+	Number int       // Number of the turn
+	Phase  TurnPhase // What the turn has come to
+	EndsAt time.Time // When the order phase ends
+	Orders Orders    // Orders given so far this turn
+}
+
+// TurnBased reports whether the game is played in turns. A game is played in
+// real time until the server starts its first turn.
+func (gs *GameState) TurnBased() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Turn != nil
+}
+
+// checkOrderPhase returns an error if the game is played in turns and the
+// player can not give orders now. It reports whether orders are queued for
+// the end of the turn rather than carried out at once.
+func (gs *GameState) checkOrderPhase() (bool, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	if gs.Turn == nil {
+		return false, nil
+	}
+	if gs.Turn.Phase != PhaseOrders {
+		return true, fmt.Errorf("error: turn %d is over, wait for the next one to give orders", gs.Turn.Number)
+	}
+	return true, nil
+}
+
+// queueSpawn orders a unit to be spawned at the end of the turn.
+func (gs *GameState) queueSpawn(u Unit) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.Turn.Phase != PhaseOrders {
+		return fmt.Errorf("error: turn %d ended before the spawn was ordered", gs.Turn.Number)
+	}
+	gs.Turn.Orders.Spawns = append(gs.Turn.Orders.Spawns, u)
+	return nil
+}
+
+// queueMove orders units to move at the end of the turn, unless one of them
+// already has orders.
+func (gs *GameState) queueMove(mv MoveOrder) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.Turn.Phase != PhaseOrders {
+		return fmt.Errorf("error: turn %d ended before the move was ordered", gs.Turn.Number)
+	}
+	for _, ordered := range gs.Turn.Orders.Moves {
+		for _, id := range mv.Units {
+			if slices.Contains(ordered.Units, id) {
+				return fmt.Errorf("error: unit %d is already ordered to %s this turn", id, ordered.ToLocation)
+			}
+		}
+	}
+	gs.Turn.Orders.Moves = append(gs.Turn.Orders.Moves, mv)
+	return nil
+}
+
+// HandleTurn follows the server's turn clock. At the start of a turn it shows
+// what the previous one revealed; at its end it closes the player's orders
+// and returns them, reporting true, so they can be sent to the server.
+func (gs *GameState) HandleTurn(ev TurnEvent) (Orders, bool) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	switch ev.Phase {
+	case PhaseOrders:
+		for _, o := range ev.Revealed {
+			printOrders(o)
+		}
+		gs.Turn = &TurnState{
+			Number: ev.Turn,
+			Phase:  PhaseOrders,
+			EndsAt: ev.EndsAt,
+			Orders: Orders{Username: gs.Player.Username, Turn: ev.Turn},
+		}
+		fmt.Printf("==== Turn %d: give your orders until %s ====\n", ev.Turn, ev.EndsAt.Local().Format(time.TimeOnly))
+		return Orders{}, false
+	case PhaseReveal:
+		if gs.Turn == nil || gs.Turn.Number != ev.Turn || gs.Turn.Phase != PhaseOrders {
+			// We joined after the turn started, so we have no orders for it
+			fmt.Printf("==== Turn %d is over ====\n", ev.Turn)
+			return Orders{}, false
+		}
+		gs.Turn.Phase = PhaseReveal
+		orders := gs.Turn.Orders
+		fmt.Printf("==== Turn %d is over: sending %d spawn(s) and %d move(s) ====\n",
+			ev.Turn, len(orders.Spawns), len(orders.Moves))
+		return orders, true
+	default:
+		fmt.Printf("error: unknown turn phase %q\n", ev.Phase)
+		return Orders{}, false
+	}
+}
+
+// printOrders describes the orders a player's turn carried out.
+func printOrders(o Orders) {
+	if len(o.Spawns) == 0 && len(o.Moves) == 0 {
+		fmt.Printf("%s gave no orders in turn %d\n", o.Username, o.Turn)
+		return
+	}
+	for _, u := range o.Spawns {
+		fmt.Printf("%s spawned a(n) %s in %s\n", o.Username, u.Rank, u.Location)
+	}
+	for _, mv := range o.Moves {
+		fmt.Printf("%s moved %d unit(s) to %s\n", o.Username, len(mv.Units), mv.ToLocation)
+	}
+}
+
+// printTurn describes the current turn for the status command.
+func (gs *GameState) printTurn() {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	if gs.Turn == nil {
+		return
+	}
+	if gs.Turn.Phase != PhaseOrders {
+		fmt.Printf("Turn %d is over; its orders are being resolved.\n", gs.Turn.Number)
+		return
+	}
+	fmt.Printf("Turn %d: you have ordered %d spawn(s) and %d move(s) until %s.\n", gs.Turn.Number,
+		len(gs.Turn.Orders.Spawns), len(gs.Turn.Orders.Moves), gs.Turn.EndsAt.Local().Format(time.TimeOnly))
+}
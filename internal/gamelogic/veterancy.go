@@ -0,0 +1,68 @@
+package gamelogic
+
+import "fmt"
+
+// Veterancy is how seasoned a unit is by the wars it has survived.
+type Veterancy string
+
+const (
+	// VeterancyRecruit units have not survived a war yet
+	VeterancyRecruit Veterancy = "recruit"
+	// VeterancyVeteran units have survived VeteranXP wars and fight with one extra power
+	VeterancyVeteran Veterancy = "veteran"
+	// VeterancyElite units have survived EliteXP wars and fight with two extra power
+	VeterancyElite Veterancy = "elite"
+)
+
+const (
+	// VeteranXP is the experience a unit needs to become a veteran.
+	VeteranXP = 1
+	// EliteXP is the experience a unit needs to become elite.
+	EliteXP = 3
+)
+
+// Veterancy returns how seasoned the unit is.
+func (u Unit) Veterancy() Veterancy {
+	switch {
+	case u.XP >= EliteXP:
+		return VeterancyElite
+	case u.XP >= VeteranXP:
+		return VeterancyVeteran
+	default:
+		return VeterancyRecruit
+	}
+}
+
+// Bonus returns the power units of the veterancy fight with on top of their
+// rank's.
+func (v Veterancy) Bonus() int {
+	switch v {
+	case VeterancyElite:
+		return 2
+	case VeterancyVeteran:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// UnitPower returns the strength unit adds to its side in a war: its rank's
+// power and its veterancy bonus. The unit must be of one of the ruleset's
+// ranks.
+func (r *Ruleset) UnitPower(unit Unit) int {
+	u, _ := r.Unit(unit.Rank)
+	return u.Power + unit.Veterancy().Bonus()
+}
+
+// HitPoints returns the hit points unit has left, which must be of one of the
+// ruleset's ranks. A unit without any is dead.
+func (r *Ruleset) HitPoints(unit Unit) int {
+	u, _ := r.Unit(unit.Rank)
+	return max(u.Health-unit.Damage, 0)
+}
+
+// describeUnit describes a unit's health and veterancy for the status command.
+func (r *Ruleset) describeUnit(unit Unit) string {
+	u, _ := r.Unit(unit.Rank)
+	return fmt.Sprintf("%d/%d HP, %s", r.HitPoints(unit), u.Health, unit.Veterancy())
+}
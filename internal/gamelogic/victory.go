@@ -0,0 +1,110 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// VictoryReason is why a game ended.
+type VictoryReason string
+
+const (
+	// VictoryElimination is a game won by the last player with an army or territory left
+	VictoryElimination VictoryReason = "elimination"
+	// VictoryTerritories is a game won by owning enough territories for long enough
+	VictoryTerritories VictoryReason = "territories"
+	// VictoryTimeLimit is a game won by the highest score when time ran out
+	VictoryTimeLimit VictoryReason = "time_limit"
+)
+
+// VictoryReasons returns every way a game can end.
+func VictoryReasons() []VictoryReason {
+	return []VictoryReason{VictoryElimination, VictoryTerritories, VictoryTimeLimit}
+}
+
+// Standing is a player's place at the end of a game.
+type Standing struct {
+	Username    string // Player the standing is for
+	Score       int    // Ten per territory owned, the power of every unit, and the gold left
+	Territories int    // Territories the player owned
+	Units       int    // Units the player had left
+	Gold        int    // Gold the player had left
+	Eliminated  bool   // Whether the player had lost every unit and territory
+}
+
+// GameOver announces the end of a game and its final standings.
+type GameOver struct {
+	Game      string        // Game that ended
+	Winner    string        // Player who won, empty on a draw
+	Reason    VictoryReason // How the game was decided
+	Standings []Standing    // Every player, best first
+	EndedAt   time.Time     // When the server ended the game
+}
+
+// Author returns the identity allowed to end games.
+func (GameOver) Author() string {
+	return routing.ServerIdentity
+}
+
+// Message describes the result of the game in one line, for the game log.
+func (over GameOver) Message() string {
+	if over.Winner == "" {
+		return fmt.Sprintf("the game ended in a draw (%s)", over.Reason)
+	}
+	switch over.Reason {
+	case VictoryElimination:
+		return fmt.Sprintf("%s won the game by eliminating every opponent", over.Winner)
+	case VictoryTerritories:
+		return fmt.Sprintf("%s won the game by holding their territories", over.Winner)
+	case VictoryTimeLimit:
+		return fmt.Sprintf("%s won the game with the highest score when time ran out", over.Winner)
+	default:
+		return fmt.Sprintf("%s won the game", over.Winner)
+	}
+}
+
+// ErrGameOver is returned for commands given once the game has ended.
+var ErrGameOver = errors.New("the game is over; use leave to return to the lobby")
+
+// HandleGameOver ends the player's game and shows how everyone finished.
+func (gs *GameState) HandleGameOver(over GameOver) {
+	gs.mu.Lock()
+	gs.Over = &over
+	gs.mu.Unlock()
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Game Over ====")
+	switch over.Winner {
+	case "":
+		fmt.Println("The game ended in a draw!")
+	case gs.GetUsername():
+		fmt.Println("You have won the game!")
+	default:
+		fmt.Printf("%s has won the game.\n", over.Winner)
+	}
+	PrintStandings(over)
+	fmt.Println("Use leave to return to the lobby.")
+}
+
+// IsOver reports whether the game has ended.
+func (gs *GameState) IsOver() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Over != nil
+}
+
+// PrintStandings prints the result of a game and every player's place.
+func PrintStandings(over GameOver) {
+	fmt.Printf("Game %s: %s\n", over.Game, over.Message())
+	for i, s := range over.Standings {
+		fmt.Printf("%d. %s: %d points, %d territories, %d units, %d gold", i+1, s.Username, s.Score, s.Territories, s.Units, s.Gold)
+		if s.Eliminated {
+			fmt.Print(" (eliminated)")
+		}
+		fmt.Println()
+	}
+}
@@ -2,6 +2,7 @@ package gamelogic
 
 import (
 	"fmt"
+	"slices"
 )
 
 // WarOutcome represents the result of a war conflict.
@@ -20,94 +21,125 @@ const (
 	WarOutcomeDraw
 )
 
-// HandleWar processes a war declaration and determines the outcome based on unit power levels.
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
+// HandleWarResult applies the server's verdict on a war to the player's
+// army: the player loses the units that were killed, and the rest carry
+// their wounds and experience.
+func (gs *GameState) HandleWarResult(r WarResult) WarOutcome {
 	defer fmt.Println("------------------------")
 	fmt.Println()
-	fmt.Println("==== War Declared ====")
-	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
+	fmt.Println("==== War Result ====")
+	fmt.Printf("%s fought %s in %s\n", r.Attacker, r.Defender, r.Location)
 
-	player := gs.GetPlayerSnap()
-
-	if player.Username == rw.Defender.Username {
-		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+	username := gs.GetUsername()
+	if username != r.Attacker && username != r.Defender {
+		fmt.Printf("%s, you are not involved in this war.\n", username)
+		return WarOutcomeNotInvolved
 	}
 
-	if player.Username != rw.Attacker.Username {
-		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+	outcome := WarOutcomeYouWon
+	switch {
+	case r.Winner == "":
+		fmt.Println("The war ended in a draw!")
+		outcome = WarOutcomeDraw
+	case r.Winner == username:
+		fmt.Printf("%s has won the war!\n", r.Winner)
+	default:
+		fmt.Printf("%s has won the war!\n", r.Winner)
+		fmt.Println("You have lost the war!")
+		outcome = WarOutcomeOpponentWon
+	}
+	for player, ids := range r.Casualties {
+		if player != username {
+			fmt.Printf("%s lost %d unit(s).\n", player, len(ids))
+		}
+	}
+	switch {
+	case slices.Contains(r.Losers, username):
+		gs.removeUnitsInLocation(r.Location)
+		fmt.Printf("Your units in %s have been killed.\n", r.Location)
+	case len(r.Casualties[username]) > 0:
+		gs.removeUnits(r.Casualties[username])
+		fmt.Printf("You lost %d unit(s) in %s: %v\n", len(r.Casualties[username]), r.Location, r.Casualties[username])
 	}
+	for _, unit := range r.Survivors[username] {
+		gs.UpdateUnit(unit)
+		fmt.Printf("Unit %d survived: %s\n", unit.ID, gs.GetScenario().Rules.describeUnit(unit))
+	}
+	return outcome
+}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
-	if overlappingLocation == "" {
-		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+// ResolveWar computes the result of a war from the players' armies, fought
+// under scenario with combat and seed where both have units. It reports
+// false if no location holds units of both.
+func ResolveWar(rw RecognitionOfWar, scenario *Scenario, combat Combat, seed int64) (WarResult, bool) {
+	loc := getOverlappingLocation(rw.Attacker, rw.Defender)
+	if loc == "" {
+		return WarResult{}, false
 	}
+	return ResolveWarIn(rw, loc, scenario, combat, seed), true
+}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
+// ResolveWarIn computes the result of a war fought in loc under scenario,
+// with combat and seed. Units out of hit points die; the rest gain a war's experience. A
+// side that loses every unit there loses the war; if both do, or neither,
+// it is a draw.
+func ResolveWarIn(rw RecognitionOfWar, loc Location, scenario *Scenario, combat Combat, seed int64) WarResult {
+	result := WarResult{
+		Attacker:   rw.Attacker.Username,
+		Defender:   rw.Defender.Username,
+		Location:   loc,
+		Combat:     combat.Kind(),
+		Seed:       seed,
+		Casualties: map[string][]int{},
+		Survivors:  map[string][]Unit{},
 	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
-		}
+	b := Battle{
+		Scenario:  scenario,
+		Location:  loc,
+		Attackers: sortedByID(unitsIn(rw.Attacker, loc)),
+		Defenders: sortedByID(unitsIn(rw.Defender, loc)),
 	}
+	attackerHits, defenderHits := combat.Fight(b, seed)
+	attackerWiped := result.tally(rw.Attacker.Username, b.Attackers, attackerHits, &scenario.Rules)
+	defenderWiped := result.tally(rw.Defender.Username, b.Defenders, defenderHits, &scenario.Rules)
 
-	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
+	if attackerWiped {
+		result.Losers = append(result.Losers, rw.Attacker.Username)
 	}
-	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
+	if defenderWiped {
+		result.Losers = append(result.Losers, rw.Defender.Username)
 	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
-	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
-		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
-		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
-	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
-		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
-		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
+	switch {
+	case defenderWiped && !attackerWiped:
+		result.Winner = rw.Attacker.Username
+	case attackerWiped && !defenderWiped:
+		result.Winner = rw.Defender.Username
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	return result
 }
 
-// unitsToPowerLevel calculates the total combat power of a list of units.
-func unitsToPowerLevel(units []Unit) int {
-	power := 0
+// tally records which of a side's units died of their hits and how the rest
+// came out of the war. It reports whether the side was wiped out.
+func (r *WarResult) tally(username string, units []Unit, hits map[int]int, rules *Ruleset) bool {
 	for _, unit := range units {
-		if unit.Rank == RankArtillery {
-			power += 10
-		}
-		if unit.Rank == RankCavalry {
-			power += 5
+		unit.Damage += hits[unit.ID]
+		if rules.HitPoints(unit) == 0 {
+			r.Casualties[username] = append(r.Casualties[username], unit.ID)
+			continue
 		}
-		if unit.Rank == RankInfantry {
-			power += 1
+		unit.XP++
+		r.Survivors[username] = append(r.Survivors[username], unit)
+	}
+	return len(r.Survivors[username]) == 0
+}
+
+// unitsIn returns the player's units stationed in loc.
+func unitsIn(p Player, loc Location) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		if unit.Location == loc {
+			units = append(units, unit)
 		}
 	}
-	return power
+	return units
 }
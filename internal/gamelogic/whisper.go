@@ -0,0 +1,35 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// CommandWhisper processes the whisper command and creates a private message to another player.
+func (gs *GameState) CommandWhisper(words []string) (routing.Whisper, error) {
+	if len(words) < 3 {
+		return routing.Whisper{}, errors.New("usage: whisper <username> <message>")
+	}
+	to := words[1]
+	if to == gs.GetUsername() {
+		return routing.Whisper{}, errors.New("you can not whisper to yourself")
+	}
+	return routing.Whisper{
+		From:    gs.GetUsername(),
+		To:      to,
+		Message: strings.Join(words[2:], " "),
+		SentAt:  time.Now(),
+	}, nil
+}
+
+// HandleWhisper displays a private message received from another player.
+func (gs *GameState) HandleWhisper(w routing.Whisper) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Printf("==== Whisper from %s ====\n", w.From)
+	fmt.Println(w.Message)
+}
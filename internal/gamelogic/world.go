@@ -0,0 +1,84 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// WorldState is the server's authoritative view of a game: every player and
+// where each of their units is.
+type WorldState struct {
+	Game       string              // Game the state describes
+	Scenario   Scenario            // Map and rules the game is played with
+	Players    []Player            // Every player of the game, sorted by username, once it has started
+	Treasuries []Treasury          // Every player's gold and income, sorted by username
+	Owners     map[Location]string // Owner of every territory somebody owns
+	LastIDs    map[string]int      // Highest unit ID each player has used, by username; new units need higher ones
+	AsOf       time.Time           // When the server took the snapshot
+	Error      string              // Why the state could not be given, if it could not
+}
+
+// Author returns the identity allowed to describe the world.
+func (WorldState) Author() string {
+	return routing.ServerIdentity
+}
+
+// Treasury returns the named player's gold and income in the world state.
+func (ws WorldState) Treasury(username string) (Treasury, bool) {
+	for _, t := range ws.Treasuries {
+		if t.Username == username {
+			return t, true
+		}
+	}
+	return Treasury{}, false
+}
+
+// Player returns the named player's view in the world state.
+func (ws WorldState) Player(username string) (Player, bool) {
+	for _, p := range ws.Players {
+		if p.Username == username {
+			return p, true
+		}
+	}
+	return Player{}, false
+}
+
+// PrintWorld prints every location and the units each player has there.
+func PrintWorld(ws WorldState) {
+	fmt.Printf("==== World of %s as of %s ====\n", ws.Game, ws.AsOf.Format(time.TimeOnly))
+	empty := true
+	for _, loc := range ws.Scenario.Map.Locations() {
+		var lines []string
+		for _, p := range ws.Players {
+			for _, unit := range p.Units {
+				if unit.Location == loc {
+					lines = append(lines, fmt.Sprintf("  * %s's %s (id %d)", p.Username, unit.Rank, unit.ID))
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		empty = false
+		slices.Sort(lines)
+		if owner := ws.Owners[loc]; owner != "" {
+			fmt.Printf("%s (owned by %s):\n", loc, owner)
+		} else {
+			fmt.Printf("%s:\n", loc)
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	if empty {
+		fmt.Println("No units on the map")
+	}
+	for _, p := range ws.Players {
+		t, _ := ws.Treasury(p.Username)
+		fmt.Printf("%s has %d unit(s), %d territories and %d gold, earning %d\n",
+			p.Username, len(p.Units), len(owned(ws.Owners, p.Username)), t.Balance, t.Income)
+	}
+}
@@ -0,0 +1,242 @@
+// Package lobby keeps the server's list of game rooms and enforces their
+// lifecycle: players create or join open rooms, mark themselves ready, and a
+// room starts once every member is ready.
+package lobby
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	// MinPlayers is the fewest players a game can start with.
+	MinPlayers = 2
+	// MaxPlayers is the largest room a player can create.
+	MaxPlayers = 8
+	// DefaultMaxPlayers is the capacity of rooms created without one.
+	DefaultMaxPlayers = 4
+)
+
+var (
+	// ErrNoRoom is returned when a request names a room that does not exist.
+	ErrNoRoom = errors.New("no such game")
+	// ErrRoomExists is returned when creating a room whose ID is taken.
+	ErrRoomExists = errors.New("game already exists")
+	// ErrRoomFull is returned when joining a room at capacity.
+	ErrRoomFull = errors.New("game is full")
+	// ErrRoomStarted is returned when joining or readying in a started room.
+	ErrRoomStarted = errors.New("game has already started")
+	// ErrInRoom is returned when a player in one room tries to enter another.
+	ErrInRoom = errors.New("already in a game")
+	// ErrNotInRoom is returned when a player outside any room leaves or readies.
+	ErrNotInRoom = errors.New("not in a game")
+)
+
+// Lobby holds every game room. It is safe for concurrent use.
+type Lobby struct {
+	// Closed, if set, is called with the ID of every room that closes
+	// because its last player left. It is called with the lobby locked.
+	Closed func(id string)
+
+	mu     sync.Mutex
+	rooms  map[string]*routing.GameRoom
+	member map[string]string // Room ID by username
+}
+
+// New returns an empty lobby.
+func New() *Lobby {
+	return &Lobby{
+		rooms:  map[string]*routing.GameRoom{},
+		member: map[string]string{},
+	}
+}
+
+// Create opens a room hosted by host, who becomes its first member.
+func (l *Lobby) Create(host, id string, maxPlayers int) (routing.GameRoom, error) {
+	if err := routing.ValidateGameID(id); err != nil {
+		return routing.GameRoom{}, err
+	}
+	if maxPlayers == 0 {
+		maxPlayers = DefaultMaxPlayers
+	}
+	if maxPlayers < MinPlayers || maxPlayers > MaxPlayers {
+		return routing.GameRoom{}, fmt.Errorf("max players must be between %d and %d", MinPlayers, MaxPlayers)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leaveFinished(host)
+	if current, ok := l.member[host]; ok {
+		return routing.GameRoom{}, fmt.Errorf("%w: %s", ErrInRoom, current)
+	}
+	if _, ok := l.rooms[id]; ok {
+		return routing.GameRoom{}, fmt.Errorf("%w: %s", ErrRoomExists, id)
+	}
+	room := &routing.GameRoom{
+		ID:         id,
+		Host:       host,
+		MaxPlayers: maxPlayers,
+		Players:    []string{host},
+		State:      routing.RoomOpen,
+	}
+	l.rooms[id] = room
+	l.member[host] = id
+	return copyRoom(room), nil
+}
+
+// Join adds username to an open room. Joining a room twice is not an error.
+func (l *Lobby) Join(username, id string) (routing.GameRoom, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	room, ok := l.rooms[id]
+	if !ok {
+		return routing.GameRoom{}, fmt.Errorf("%w: %s", ErrNoRoom, id)
+	}
+	l.leaveFinished(username)
+	if current, ok := l.member[username]; ok {
+		if current == id {
+			return copyRoom(room), nil
+		}
+		return routing.GameRoom{}, fmt.Errorf("%w: %s", ErrInRoom, current)
+	}
+	if room.State != routing.RoomOpen {
+		return routing.GameRoom{}, fmt.Errorf("%w: %s", ErrRoomStarted, id)
+	}
+	if len(room.Players) >= room.MaxPlayers {
+		return routing.GameRoom{}, fmt.Errorf("%w: %s", ErrRoomFull, id)
+	}
+	room.Players = append(room.Players, username)
+	l.member[username] = id
+	return copyRoom(room), nil
+}
+
+// Leave removes username from their room. Empty rooms are closed, and a
+// departing host hands the room to its longest-standing member. It reports
+// whether the departure started the room, which happens when everyone left
+// behind is ready.
+func (l *Lobby) Leave(username string) (routing.GameRoom, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	room, ok := l.remove(username)
+	if !ok {
+		return routing.GameRoom{}, false, ErrNotInRoom
+	}
+	started := room.State == routing.RoomOpen && tryStart(room)
+	return copyRoom(room), started, nil
+}
+
+// remove takes username out of their room, closing it if it is left empty,
+// and returns the room. The lobby must be locked.
+func (l *Lobby) remove(username string) (*routing.GameRoom, bool) {
+	id, ok := l.member[username]
+	if !ok {
+		return nil, false
+	}
+	room := l.rooms[id]
+	delete(l.member, username)
+	room.Players = slices.DeleteFunc(room.Players, func(p string) bool { return p == username })
+	room.Ready = slices.DeleteFunc(room.Ready, func(p string) bool { return p == username })
+	if len(room.Players) == 0 {
+		delete(l.rooms, id)
+		if l.Closed != nil {
+			l.Closed(id)
+		}
+	} else if room.Host == username {
+		room.Host = room.Players[0]
+	}
+	return room, true
+}
+
+// leaveFinished takes username out of their room if its game is over, so
+// that they can move on without leaving it first. The lobby must be locked.
+func (l *Lobby) leaveFinished(username string) {
+	if id, ok := l.member[username]; ok && l.rooms[id].State == routing.RoomFinished {
+		l.remove(username)
+	}
+}
+
+// SetReady marks username ready or not. It reports whether the change
+// started the room, which happens once at least MinPlayers members are all ready.
+func (l *Lobby) SetReady(username string, ready bool) (routing.GameRoom, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id, ok := l.member[username]
+	if !ok {
+		return routing.GameRoom{}, false, ErrNotInRoom
+	}
+	room := l.rooms[id]
+	if room.State != routing.RoomOpen {
+		return routing.GameRoom{}, false, fmt.Errorf("%w: %s", ErrRoomStarted, id)
+	}
+
+	isReady := slices.Contains(room.Ready, username)
+	switch {
+	case ready && !isReady:
+		room.Ready = append(room.Ready, username)
+	case !ready && isReady:
+		room.Ready = slices.DeleteFunc(room.Ready, func(p string) bool { return p == username })
+	}
+
+	started := tryStart(room)
+	return copyRoom(room), started, nil
+}
+
+// tryStart starts an open room once at least MinPlayers members are all
+// ready, and reports whether it did.
+func tryStart(room *routing.GameRoom) bool {
+	if len(room.Players) < MinPlayers || len(room.Ready) != len(room.Players) {
+		return false
+	}
+	room.State = routing.RoomStarted
+	return true
+}
+
+// Finish marks a started room as played to the end. Its players stay in it
+// until they leave, which closes it once the last of them has, or until they
+// create or join another room.
+func (l *Lobby) Finish(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	room, ok := l.rooms[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoRoom, id)
+	}
+	room.State = routing.RoomFinished
+	return nil
+}
+
+// Room returns the room with the given ID.
+func (l *Lobby) Room(id string) (routing.GameRoom, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	room, ok := l.rooms[id]
+	if !ok {
+		return routing.GameRoom{}, false
+	}
+	return copyRoom(room), true
+}
+
+// Rooms returns every room, sorted by ID.
+func (l *Lobby) Rooms() []routing.GameRoom {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rooms := make([]routing.GameRoom, 0, len(l.rooms))
+	for _, room := range l.rooms {
+		rooms = append(rooms, copyRoom(room))
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms
+}
+
+// copyRoom returns a room that shares no slices with the lobby's.
+func copyRoom(room *routing.GameRoom) routing.GameRoom {
+	c := *room
+	c.Players = slices.Clone(room.Players)
+	c.Ready = slices.Clone(room.Ready)
+	return c
+}
@@ -0,0 +1,103 @@
+package lobby
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func TestLeaveStartsRoomWhenEveryoneLeftIsReady(t *testing.T) {
+	l := New()
+	l.Create("alice", "friday", 4)
+	l.Join("bob", "friday")
+	l.Join("carol", "friday")
+	l.SetReady("alice", true)
+	l.SetReady("bob", true)
+
+	room, started, err := l.Leave("carol")
+	if err != nil {
+		t.Fatalf("could not leave: %v", err)
+	}
+	if !started || room.State != routing.RoomStarted {
+		t.Errorf("room is %s after the only unready player left, want started", room.State)
+	}
+}
+
+func TestFinishFreesPlayers(t *testing.T) {
+	l := New()
+	l.Create("alice", "friday", 2)
+	l.Join("bob", "friday")
+	l.SetReady("alice", true)
+	l.SetReady("bob", true)
+
+	if err := l.Finish("friday"); err != nil {
+		t.Fatalf("could not finish: %v", err)
+	}
+	if _, err := l.Create("alice", "saturday", 2); err != nil {
+		t.Errorf("could not create a game after finishing one: %v", err)
+	}
+	if _, err := l.Join("bob", "saturday"); err != nil {
+		t.Errorf("could not join a game after finishing one: %v", err)
+	}
+	if _, ok := l.Room("friday"); ok {
+		t.Error("finished room outlived its players")
+	}
+}
+
+func TestLeaveFinishedRoom(t *testing.T) {
+	l := New()
+	l.Create("alice", "friday", 2)
+	l.Join("bob", "friday")
+	l.SetReady("alice", true)
+	l.SetReady("bob", true)
+	if err := l.Finish("friday"); err != nil {
+		t.Fatalf("could not finish: %v", err)
+	}
+
+	room, started, err := l.Leave("alice")
+	if err != nil {
+		t.Fatalf("could not leave a finished game: %v", err)
+	}
+	if started || room.State != routing.RoomFinished {
+		t.Errorf("room is %s after leaving it, want finished", room.State)
+	}
+	if rooms := l.Rooms(); len(rooms) != 1 {
+		t.Errorf("lobby lists %d rooms while bob is still in the finished one, want 1", len(rooms))
+	}
+	if _, _, err := l.Leave("bob"); err != nil {
+		t.Fatalf("could not leave a finished game: %v", err)
+	}
+	if rooms := l.Rooms(); len(rooms) != 0 {
+		t.Errorf("lobby lists %v after everyone left, want none", rooms)
+	}
+	if _, _, err := l.Leave("bob"); !errors.Is(err, ErrNotInRoom) {
+		t.Errorf("leaving twice returned %v, want %v", err, ErrNotInRoom)
+	}
+	if _, err := l.Create("bob", "friday", 2); err != nil {
+		t.Errorf("could not reuse the ID of a finished game: %v", err)
+	}
+}
+
+func TestClosedIsCalledWhenLastPlayerLeaves(t *testing.T) {
+	l := New()
+	var closed []string
+	l.Closed = func(id string) { closed = append(closed, id) }
+	l.Create("alice", "friday", 2)
+	l.Join("bob", "friday")
+	l.SetReady("alice", true)
+	l.SetReady("bob", true)
+	l.Finish("friday")
+
+	l.Leave("alice")
+	if len(closed) != 0 {
+		t.Fatalf("room closed with bob still in it: %v", closed)
+	}
+	// Moving on from a finished game leaves it too
+	l.Create("bob", "saturday", 2)
+	l.Leave("bob")
+	if want := []string{"friday", "saturday"}; !slices.Equal(closed, want) {
+		t.Errorf("closed rooms = %v, want %v", closed, want)
+	}
+}
@@ -0,0 +1,87 @@
+// Package presence tracks which players are online from their heartbeats.
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	// HeartbeatInterval is how often clients announce they are online.
+	HeartbeatInterval = 5 * time.Second
+	// Timeout is how long after their last heartbeat a player is considered gone.
+	Timeout = 3 * HeartbeatInterval
+)
+
+// Player is a row of the presence table.
+type Player struct {
+	Username  string    // The online player
+	Game      string    // Game the player is in, empty in the lobby
+	FirstSeen time.Time // When the player came online
+	LastSeen  time.Time // When the player's latest heartbeat arrived
+}
+
+// Table records the online players. It is safe for concurrent use.
+type Table struct {
+	mu      sync.Mutex
+	players map[string]*Player
+}
+
+// NewTable returns an empty presence table.
+func NewTable() *Table {
+	return &Table{players: map[string]*Player{}}
+}
+
+// Beat records a heartbeat received at now and returns the presence change
+// it causes, if any: players come online on their first heartbeat and leave
+// on a heartbeat that says so.
+func (t *Table) Beat(hb routing.Heartbeat, now time.Time) (routing.PresenceEvent, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, online := t.players[hb.Username]
+	switch {
+	case hb.Leaving && !online:
+		return routing.PresenceEvent{}, false
+	case hb.Leaving:
+		delete(t.players, hb.Username)
+		return routing.PresenceEvent{Username: hb.Username, Kind: routing.PresenceLeft, Game: hb.Game, At: now}, true
+	case online:
+		p.Game = hb.Game
+		p.LastSeen = now
+		return routing.PresenceEvent{}, false
+	}
+	t.players[hb.Username] = &Player{Username: hb.Username, Game: hb.Game, FirstSeen: now, LastSeen: now}
+	return routing.PresenceEvent{Username: hb.Username, Kind: routing.PresenceJoined, Game: hb.Game, At: now}, true
+}
+
+// Expire removes players whose last heartbeat is older than Timeout and
+// returns a timeout event for each.
+func (t *Table) Expire(now time.Time) []routing.PresenceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []routing.PresenceEvent
+	for username, p := range t.players {
+		if now.Sub(p.LastSeen) <= Timeout {
+			continue
+		}
+		delete(t.players, username)
+		events = append(events, routing.PresenceEvent{Username: username, Kind: routing.PresenceTimedOut, Game: p.Game, At: now})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Username < events[j].Username })
+	return events
+}
+
+// Online returns every online player, sorted by username.
+func (t *Table) Online() []Player {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	players := make([]Player, 0, len(t.players))
+	for _, p := range t.players {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Username < players[j].Username })
+	return players
+}
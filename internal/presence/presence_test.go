@@ -0,0 +1,145 @@
+package presence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// step is a heartbeat or, when expire is set, an expiry sweep, happening at
+// an offset from the start of a test case.
+type step struct {
+	at     time.Duration
+	hb     routing.Heartbeat
+	expire bool
+}
+
+func TestTable(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tests := []struct {
+		name   string
+		steps  []step
+		events []routing.PresenceEvent // Every change the steps cause, in order
+		online []string
+	}{
+		{
+			name:   "first heartbeat joins",
+			steps:  []step{{at: 0, hb: routing.Heartbeat{Username: "alice", Game: "friday"}}},
+			events: []routing.PresenceEvent{{Username: "alice", Kind: routing.PresenceJoined, Game: "friday", At: at(0)}},
+			online: []string{"alice"},
+		},
+		{
+			name: "later heartbeats are quiet",
+			steps: []step{
+				{at: 0, hb: routing.Heartbeat{Username: "alice"}},
+				{at: HeartbeatInterval, hb: routing.Heartbeat{Username: "alice", Game: "friday"}},
+			},
+			events: []routing.PresenceEvent{{Username: "alice", Kind: routing.PresenceJoined, At: at(0)}},
+			online: []string{"alice"},
+		},
+		{
+			name: "leaving heartbeat leaves",
+			steps: []step{
+				{at: 0, hb: routing.Heartbeat{Username: "alice"}},
+				{at: time.Second, hb: routing.Heartbeat{Username: "alice", Game: "friday", Leaving: true}},
+			},
+			events: []routing.PresenceEvent{
+				{Username: "alice", Kind: routing.PresenceJoined, At: at(0)},
+				{Username: "alice", Kind: routing.PresenceLeft, Game: "friday", At: at(time.Second)},
+			},
+		},
+		{
+			name:  "leaving while offline is ignored",
+			steps: []step{{at: 0, hb: routing.Heartbeat{Username: "alice", Leaving: true}}},
+		},
+		{
+			name: "not expired at the timeout",
+			steps: []step{
+				{at: 0, hb: routing.Heartbeat{Username: "alice"}},
+				{at: Timeout, expire: true},
+			},
+			events: []routing.PresenceEvent{{Username: "alice", Kind: routing.PresenceJoined, At: at(0)}},
+			online: []string{"alice"},
+		},
+		{
+			name: "expired after the timeout",
+			steps: []step{
+				{at: 0, hb: routing.Heartbeat{Username: "bob", Game: "friday"}},
+				{at: 0, hb: routing.Heartbeat{Username: "alice"}},
+				{at: HeartbeatInterval, hb: routing.Heartbeat{Username: "carol"}},
+				{at: Timeout + time.Second, expire: true},
+			},
+			events: []routing.PresenceEvent{
+				{Username: "bob", Kind: routing.PresenceJoined, Game: "friday", At: at(0)},
+				{Username: "alice", Kind: routing.PresenceJoined, At: at(0)},
+				{Username: "carol", Kind: routing.PresenceJoined, At: at(HeartbeatInterval)},
+				{Username: "alice", Kind: routing.PresenceTimedOut, At: at(Timeout + time.Second)},
+				{Username: "bob", Kind: routing.PresenceTimedOut, Game: "friday", At: at(Timeout + time.Second)},
+			},
+			online: []string{"carol"},
+		},
+		{
+			name: "heartbeats keep a player online",
+			steps: []step{
+				{at: 0, hb: routing.Heartbeat{Username: "alice"}},
+				{at: Timeout, hb: routing.Heartbeat{Username: "alice"}},
+				{at: Timeout + time.Second, expire: true},
+			},
+			events: []routing.PresenceEvent{{Username: "alice", Kind: routing.PresenceJoined, At: at(0)}},
+			online: []string{"alice"},
+		},
+		{
+			name: "rejoins after expiring",
+			steps: []step{
+				{at: 0, hb: routing.Heartbeat{Username: "alice"}},
+				{at: 2 * Timeout, expire: true},
+				{at: 2 * Timeout, hb: routing.Heartbeat{Username: "alice"}},
+			},
+			events: []routing.PresenceEvent{
+				{Username: "alice", Kind: routing.PresenceJoined, At: at(0)},
+				{Username: "alice", Kind: routing.PresenceTimedOut, At: at(2 * Timeout)},
+				{Username: "alice", Kind: routing.PresenceJoined, At: at(2 * Timeout)},
+			},
+			online: []string{"alice"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable()
+			var events []routing.PresenceEvent
+			for _, s := range tt.steps {
+				if s.expire {
+					events = append(events, table.Expire(at(s.at))...)
+				} else if ev, ok := table.Beat(s.hb, at(s.at)); ok {
+					events = append(events, ev)
+				}
+			}
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %+v, want %+v", events, tt.events)
+			}
+			var online []string
+			for _, p := range table.Online() {
+				online = append(online, p.Username)
+			}
+			if !reflect.DeepEqual(online, tt.online) {
+				t.Errorf("online = %v, want %v", online, tt.online)
+			}
+		})
+	}
+}
+
+func TestBeatUpdatesPlayer(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	table := NewTable()
+	table.Beat(routing.Heartbeat{Username: "alice"}, start)
+	table.Beat(routing.Heartbeat{Username: "alice", Game: "friday"}, start.Add(HeartbeatInterval))
+
+	want := []Player{{Username: "alice", Game: "friday", FirstSeen: start, LastSeen: start.Add(HeartbeatInterval)}}
+	if got := table.Online(); !reflect.DeepEqual(got, want) {
+		t.Errorf("online = %+v, want %+v", got, want)
+	}
+}
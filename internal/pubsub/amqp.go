@@ -0,0 +1,111 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPTransport is a Transport backed by an AMQP 0-9-1 connection to RabbitMQ.
+type AMQPTransport struct {
+	conn  *amqp.Connection // Underlying RabbitMQ connection
+	pubCh *amqp.Channel    // Channel used for publishing
+}
+
+// DialAMQP connects to the RabbitMQ server at url and returns a Transport for it.
+func DialAMQP(url string) (*AMQPTransport, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to RabbitMQ server %s: %w", url, err)
+	}
+
+	pubCh, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not create channel: %w", err)
+	}
+
+	return &AMQPTransport{conn: conn, pubCh: pubCh}, nil
+}
+
+// Publish sends msg to the exchange with the given routing key.
+func (t *AMQPTransport) Publish(exchange, key string, msg Message) error {
+	var headers amqp.Table
+	if len(msg.Headers) > 0 {
+		headers = amqp.Table{}
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+	}
+
+	return t.pubCh.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		Headers:         headers,
+		Body:            msg.Body,
+	})
+}
+
+// Subscribe declares and binds a queue and consumes it in a background goroutine.
+func (t *AMQPTransport) Subscribe(
+	exchange, // Exchange name to bind to
+	queueName, // Queue name to create/consume from
+	key string, // Routing key for binding
+	queueType SimpleQueueType, // Queue persistence type
+	handler func(Message) AckType, // Message handler function
+) error {
+	amqpChann, _, err := DeclareAndBind(t.conn, exchange, queueName, key, queueType)
+	if err != nil {
+		return err
+	}
+
+	newChann, err := amqpChann.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for m := range newChann {
+			settle(messageFromDelivery(m), amqpAcknowledger{m}, handler)
+		}
+	}()
+
+	return nil
+}
+
+// Close closes the publish channel and the connection.
+func (t *AMQPTransport) Close() error {
+	t.pubCh.Close()
+	return t.conn.Close()
+}
+
+// amqpAcknowledger settles an AMQP delivery.
+type amqpAcknowledger struct {
+	d amqp.Delivery
+}
+
+func (a amqpAcknowledger) ack() error {
+	return a.d.Ack(false)
+}
+
+func (a amqpAcknowledger) nack(requeue bool) error {
+	return a.d.Nack(false, requeue)
+}
+
+// messageFromDelivery converts an AMQP delivery into a Message.
+func messageFromDelivery(d amqp.Delivery) Message {
+	headers := map[string]string{}
+	for k, v := range d.Headers {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	return Message{
+		RoutingKey:      d.RoutingKey,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		Headers:         headers,
+		Body:            d.Body,
+	}
+}
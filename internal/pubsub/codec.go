@@ -0,0 +1,67 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec converts values to and from message bodies.
+type Codec interface {
+	// Encode serialises val into a message body with its content headers set.
+	Encode(val any) (Message, error)
+	// Decode deserialises a message body into target, which must be a pointer.
+	Decode(msg Message, target any) error
+	// ContentType returns the MIME type of encoded bodies.
+	ContentType() string
+}
+
+var (
+	// JSON encodes messages as application/json
+	JSON Codec = jsonCodec{}
+	// Gob encodes messages as application/gob
+	Gob Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Encode(val any) (Message, error) {
+	jsonVal, err := json.Marshal(val)
+	if err != nil {
+		return Message{}, fmt.Errorf("could not marshal value to json: %w", err)
+	}
+	return Message{ContentType: jsonCodec{}.ContentType(), Body: jsonVal}, nil
+}
+
+func (jsonCodec) Decode(msg Message, target any) error {
+	if err := json.Unmarshal(msg.Body, target); err != nil {
+		return fmt.Errorf("could not unmarshall %s: %s", msg.Body, err)
+	}
+	return nil
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string {
+	return "application/gob"
+}
+
+func (gobCodec) Encode(val any) (Message, error) {
+	var gobVal bytes.Buffer
+	if err := gob.NewEncoder(&gobVal).Encode(val); err != nil {
+		return Message{}, fmt.Errorf("could not encode value to gob: %w", err)
+	}
+	return Message{ContentType: gobCodec{}.ContentType(), Body: gobVal.Bytes()}, nil
+}
+
+func (gobCodec) Decode(msg Message, target any) error {
+	if err := gob.NewDecoder(bytes.NewReader(msg.Body)).Decode(target); err != nil {
+		return fmt.Errorf("could not decode %s: %w", msg.Body, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package pubsub
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// EncodingGzip compresses bodies with gzip
+	EncodingGzip = "gzip"
+	// EncodingDeflate compresses bodies with raw DEFLATE
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressionThreshold is the body size below which compression is skipped.
+const DefaultCompressionThreshold = 1024
+
+// maxDecompressedSize bounds how large a compressed body may expand.
+const maxDecompressedSize = 16 << 20
+
+// ErrUnknownEncoding is returned for a content encoding this package cannot decode.
+var ErrUnknownEncoding = errors.New("unknown content encoding")
+
+// CompressedCodec wraps a Codec and compresses bodies of at least Threshold
+// bytes, recording the algorithm in the message's content encoding.
+type CompressedCodec struct {
+	Inner     Codec  // Codec for the uncompressed payload
+	Encoding  string // EncodingGzip or EncodingDeflate, empty disables compression
+	Threshold int    // Bodies smaller than this are sent uncompressed
+}
+
+// Compress returns a codec that compresses inner's output with encoding.
+func Compress(inner Codec, encoding string, threshold int) CompressedCodec {
+	return CompressedCodec{Inner: inner, Encoding: encoding, Threshold: threshold}
+}
+
+// ContentType returns the inner codec's content type; compression only sets the encoding.
+func (c CompressedCodec) ContentType() string {
+	return c.Inner.ContentType()
+}
+
+// Encode serialises val with the inner codec and compresses large bodies.
+func (c CompressedCodec) Encode(val any) (Message, error) {
+	msg, err := c.Inner.Encode(val)
+	if err != nil {
+		return Message{}, err
+	}
+	if c.Encoding == "" || msg.ContentEncoding != "" || len(msg.Body) < c.Threshold {
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c.Encoding {
+	case EncodingGzip:
+		w = gzip.NewWriter(&buf)
+	case EncodingDeflate:
+		w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("%w: %s", ErrUnknownEncoding, c.Encoding)
+	}
+	if _, err := w.Write(msg.Body); err != nil {
+		return Message{}, fmt.Errorf("could not compress body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return Message{}, fmt.Errorf("could not compress body: %w", err)
+	}
+
+	msg.Body = buf.Bytes()
+	msg.ContentEncoding = c.Encoding
+	return msg, nil
+}
+
+// Decode decompresses the body if needed and deserialises it with the inner codec.
+func (c CompressedCodec) Decode(msg Message, target any) error {
+	msg, err := decompress(msg)
+	if err != nil {
+		return err
+	}
+	return c.Inner.Decode(msg, target)
+}
+
+// decompress undoes the message's content encoding, if any.
+func decompress(msg Message) (Message, error) {
+	var r io.Reader
+	switch msg.ContentEncoding {
+	case "", "identity":
+		return msg, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(msg.Body))
+		if err != nil {
+			return Message{}, fmt.Errorf("could not decompress body: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case EncodingDeflate:
+		fr := flate.NewReader(bytes.NewReader(msg.Body))
+		defer fr.Close()
+		r = fr
+	default:
+		return Message{}, fmt.Errorf("%w: %s", ErrUnknownEncoding, msg.ContentEncoding)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return Message{}, fmt.Errorf("could not decompress body: %w", err)
+	}
+	if len(body) > maxDecompressedSize {
+		return Message{}, errors.New("decompressed body too large")
+	}
+	msg.Body = body
+	msg.ContentEncoding = ""
+	return msg, nil
+}
@@ -1,10 +1,7 @@
-// Package pubsub provides functionality for RabbitMQ message publishing and consumption.
+// Package pubsub provides message publishing and consumption over RabbitMQ, using either AMQP 0-9-1 or STOMP 1.2.
 package pubsub
 
 import (
-	"bytes"
-	"encoding/gob"
-	"encoding/json"
 	"fmt"
 	"log"
 
@@ -21,93 +18,86 @@ const (
 	SimpleQueueTransient
 )
 
+// DeadLetterExchange is the exchange that rejected messages are routed to.
+const DeadLetterExchange = "peril_dlx"
+
+// AckType tells the broker how a consumed message should be settled.
 type AckType int
 
 const (
+	// Ack acknowledges the message as processed
 	Ack AckType = iota
+	// NackRequeue rejects the message and puts it back on the queue
 	NackRequeue
+	// NackDiscard rejects the message and dead-letters it
 	NackDiscard
 )
 
-func subscribe[T any](
-	conn *amqp.Connection,
+// Subscribe subscribes to a queue and handles messages of type T decoded with
+// codec. Compressed bodies are transparently decompressed first.
+func Subscribe[T any](
+	t Transport,
 	exchange, // Exchange name to bind to
 	queueName, // Queue name to create/consume from
 	key string, // Routing key for binding
 	queueType SimpleQueueType, // Queue persistence type
 	handler func(T) AckType, // Message handler function
-	unmarshaller func([]byte) (T, error),
+	codec Codec, // Decoder for message bodies
 ) error {
-	amqpChann, _, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
-	if err != nil {
-		return err
-	}
-
-	newChann, err := amqpChann.Consume(queueName, "", false, false, false, false, nil)
-	if err != nil {
-		return err
-	}
+	return subscribe(t, exchange, queueName, key, queueType, func(val T, _ Message) AckType {
+		return handler(val)
+	}, codec)
+}
 
-	go func() {
-		for m := range newChann {
-			target, err := unmarshaller(m.Body)
-			if err != nil {
-				log.Printf("could not unmarshall %s: %s", m.Body, err)
-				continue
-			}
-
-			ackType := handler(target)
-			switch ackType {
-			case Ack:
-				err = m.Ack(false)
-				log.Printf("Positive acknowledgement of type %s", ackType.String())
-			case NackRequeue:
-				err = m.Nack(false, true)
-				log.Printf("Negative acknowledgement of type %s...requeueing", ackType.String())
-			case NackDiscard:
-				err = m.Nack(false, false)
-				log.Printf("Negative acknowledgement of type %s...discarding", ackType.String())
-			default:
-				log.Printf("Invalid acknowledge type %v: %v", ackType, err)
-			}
-			if err != nil {
-				log.Printf("Could not acknowledge message %s: %v", m.Body, err)
-			}
+// subscribe is Subscribe for handlers that also need the message, e.g. its routing key.
+func subscribe[T any](
+	t Transport,
+	exchange, queueName, key string,
+	queueType SimpleQueueType,
+	handler func(T, Message) AckType,
+	codec Codec,
+) error {
+	return t.Subscribe(exchange, queueName, key, queueType, func(msg Message) AckType {
+		var target T
+		plain, err := decompress(msg)
+		if err != nil {
+			log.Printf("could not decompress message on %s: %s", msg.RoutingKey, err)
+			return NackDiscard
 		}
-	}()
-
-	return nil
+		if err := codec.Decode(plain, &target); err != nil {
+			log.Printf("could not unmarshall %s: %s", msg.Body, err)
+			return NackDiscard
+		}
+		if err := checkAuthor(target, msg); err != nil {
+			log.Printf("rejecting message on %s: %v", msg.RoutingKey, err)
+			return NackDiscard
+		}
+		return handler(target, msg)
+	})
 }
 
-// SubscribeJSON subscribes to a RabbitMQ queue and handles JSON messages of type T.
+// SubscribeJSON subscribes to a queue and handles JSON messages of type T.
 func SubscribeJSON[T any](
-	conn *amqp.Connection,
+	t Transport,
 	exchange, // Exchange name to bind to
 	queueName, // Queue name to create/consume from
 	key string, // Routing key for binding
 	queueType SimpleQueueType, // Queue persistence type
 	handler func(T) AckType, // Message handler function
 ) error {
-	err := subscribe(conn, exchange, queueName, key, queueType, handler, unmarshalJSON)
-	if err != nil {
-		return err
-	}
-	return nil
+	return Subscribe(t, exchange, queueName, key, queueType, handler, JSON)
 }
 
+// SubscribeGob subscribes to a queue and handles gob-encoded messages of type T.
 func SubscribeGob[T any](
-	conn *amqp.Connection,
+	t Transport,
 	exchange, // Exchange name to bind to
 	queueName, // Queue name to create/consume from
 	key string, // Routing key for binding
 	queueType SimpleQueueType, // Queue persistence type
 	handler func(T) AckType, // Message handler function
 ) error {
-	err := subscribe(conn, exchange, queueName, key, queueType, handler, unmarshalGob)
-	if err != nil {
-		return err
-	}
-	return nil
+	return Subscribe(t, exchange, queueName, key, queueType, handler, Gob)
 }
 
 // DeclareAndBind creates a RabbitMQ channel, declares a queue, and binds it to an exchange.
@@ -128,11 +118,11 @@ func DeclareAndBind(
 	switch queueType {
 	case SimpleQueueDurable:
 		newQueue, err = chann.QueueDeclare(queueName, true, false, false, false, amqp.Table{
-			"x-dead-letter-exchange": "peril_dlx",
+			"x-dead-letter-exchange": DeadLetterExchange,
 		})
 	case SimpleQueueTransient:
 		newQueue, err = chann.QueueDeclare(queueName, false, true, true, false, amqp.Table{
-			"x-dead-letter-exchange": "peril_dlx",
+			"x-dead-letter-exchange": DeadLetterExchange,
 		})
 	default:
 		return nil, amqp.Queue{}, fmt.Errorf("invalid queue type: %v", queueType)
@@ -176,21 +166,3 @@ func (a AckType) String() string {
 		return fmt.Sprintf("Unknown(%d)", a)
 	}
 }
-
-func unmarshalJSON[T any](source []byte) (T, error) {
-	var target T
-	if err := json.Unmarshal(source, &target); err != nil {
-		return target, fmt.Errorf("could not unmarshall %s: %s", source, err)
-	}
-	return target, nil
-}
-
-func unmarshalGob[T any](source []byte) (T, error) {
-	var target T
-	sourceStream := bytes.NewReader(source)
-	if err := gob.NewDecoder(sourceStream).Decode(&target); err != nil {
-		return target, fmt.Errorf("could not decode %s: %w", source, err)
-	}
-
-	return target, nil
-}
@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrKeyConflict is returned when an identity is already bound to a different key.
+var ErrKeyConflict = errors.New("identity is registered with a different key")
+
+// Keyring maps identities to their Ed25519 signing keys and X25519
+// encryption keys. The first key seen for an identity wins; later attempts to
+// rebind it are rejected.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string]ed25519.PublicKey
+	boxKeys map[string]*ecdh.PublicKey
+}
+
+// NewKeyring creates an empty keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys:    map[string]ed25519.PublicKey{},
+		boxKeys: map[string]*ecdh.PublicKey{},
+	}
+}
+
+// Add binds an identity to a public key.
+func (k *Keyring) Add(identity string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key for %s", identity)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if existing, ok := k.keys[identity]; ok {
+		if !existing.Equal(key) {
+			return fmt.Errorf("%w: %s", ErrKeyConflict, identity)
+		}
+		return nil
+	}
+	k.keys[identity] = bytes.Clone(key)
+	return nil
+}
+
+// Lookup returns the key registered for an identity.
+func (k *Keyring) Lookup(identity string) (ed25519.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[identity]
+	return key, ok
+}
+
+// Export returns a copy of every registered key.
+func (k *Keyring) Export() map[string][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := make(map[string][]byte, len(k.keys))
+	for id, key := range k.keys {
+		out[id] = bytes.Clone(key)
+	}
+	return out
+}
+
+// AddEncryptionKey binds an identity to the X25519 key messages for it are sealed with.
+func (k *Keyring) AddEncryptionKey(identity string, key []byte) error {
+	pub, err := ecdh.X25519().NewPublicKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid encryption key for %s: %w", identity, err)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if existing, ok := k.boxKeys[identity]; ok {
+		if !existing.Equal(pub) {
+			return fmt.Errorf("%w: %s", ErrKeyConflict, identity)
+		}
+		return nil
+	}
+	k.boxKeys[identity] = pub
+	return nil
+}
+
+// LookupEncryptionKey returns the encryption key registered for an identity.
+func (k *Keyring) LookupEncryptionKey(identity string) (*ecdh.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.boxKeys[identity]
+	return key, ok
+}
+
+// ExportEncryptionKeys returns a copy of every registered encryption key.
+func (k *Keyring) ExportEncryptionKeys() map[string][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := make(map[string][]byte, len(k.boxKeys))
+	for id, key := range k.boxKeys {
+		out[id] = key.Bytes()
+	}
+	return out
+}
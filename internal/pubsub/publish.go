@@ -1,39 +1,20 @@
 package pubsub
 
-import (
-	"bytes"
-	"context"
-	"encoding/gob"
-	"encoding/json"
-	"fmt"
-
-	amqp "github.com/rabbitmq/amqp091-go"
-)
-
-// PublishJSON marshals a value to JSON and publishes it to a RabbitMQ exchange.
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
-	jsonVal, err := json.Marshal(val)
+// Publish encodes a value with codec and publishes it to an exchange.
+func Publish[T any](t Transport, exchange, key string, val T, codec Codec) error {
+	msg, err := codec.Encode(val)
 	if err != nil {
-		return fmt.Errorf("could not marshal value to json: %w", err)
+		return err
 	}
-
-	return ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{
-		ContentType: "application/json",
-		Body:        jsonVal,
-	})
+	return t.Publish(exchange, key, msg)
 }
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
-	var gobVal bytes.Buffer
-	encoder := gob.NewEncoder(&gobVal)
-
-	err := encoder.Encode(val)
-	if err != nil {
-		return fmt.Errorf("could not encode value to gob: %w", err)
-	}
+// PublishJSON marshals a value to JSON and publishes it to an exchange.
+func PublishJSON[T any](t Transport, exchange, key string, val T) error {
+	return Publish(t, exchange, key, val, JSON)
+}
 
-	return ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{
-		ContentType: "application/gob",
-		Body:        gobVal.Bytes(),
-	})
+// PublishGob encodes a value with gob and publishes it to an exchange.
+func PublishGob[T any](t Transport, exchange, key string, val T) error {
+	return Publish(t, exchange, key, val, Gob)
 }
@@ -0,0 +1,174 @@
+package pubsub
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Route describes one kind of message in the game: the exchange it travels
+// on, its routing key template, its payload type and how it is encoded.
+// Publishers and subscribers that share a Route cannot disagree on the payload
+// type, because handlers and values are checked against T at compile time.
+type Route[T any] struct {
+	Name     string          // Identifier of the route
+	Exchange string          // Exchange messages are published to
+	Key      string          // Routing key template, e.g. "army_moves.{username}"
+	Codec    Codec           // Encoding of the payload
+	Queue    SimpleQueueType // Persistence of subscriber queues
+}
+
+// RouteInfo is the type-erased description of a Route.
+type RouteInfo struct {
+	Name        string          // Identifier of the route
+	Exchange    string          // Exchange messages are published to
+	Key         string          // Routing key template
+	ContentType string          // MIME type of encoded payloads
+	Queue       SimpleQueueType // Persistence of subscriber queues
+	Version     int             // Schema version of the payload, 0 if unversioned
+	Payload     reflect.Type    // Go type of the payload
+}
+
+// Info describes the route without its type parameter.
+func (r Route[T]) Info() RouteInfo {
+	return RouteInfo{
+		Name:        r.Name,
+		Exchange:    r.Exchange,
+		Key:         r.Key,
+		ContentType: r.Codec.ContentType(),
+		Queue:       r.Queue,
+		Version:     versionOf(r.Codec),
+		Payload:     reflect.TypeFor[T](),
+	}
+}
+
+// WithCodec returns a copy of the route that encodes payloads with codec,
+// e.g. a compressing or sealing wrapper around the route's own codec.
+func (r Route[T]) WithCodec(codec Codec) Route[T] {
+	r.Codec = codec
+	return r
+}
+
+// RoutingKey fills the key template's placeholders with params, in order.
+// Each param must be a valid routing key segment.
+func (r Route[T]) RoutingKey(params ...string) (string, error) {
+	segments := strings.Split(r.Key, routing.KeySeparator)
+	used := 0
+	for i, segment := range segments {
+		if !isPlaceholder(segment) {
+			continue
+		}
+		if used == len(params) {
+			return "", fmt.Errorf("route %s: missing value for %s", r.Name, segment)
+		}
+		if err := routing.ValidateSegment(params[used]); err != nil {
+			return "", fmt.Errorf("route %s: %s: %w", r.Name, segment, err)
+		}
+		segments[i] = params[used]
+		used++
+	}
+	if used != len(params) {
+		return "", fmt.Errorf("route %s: %d unused key parameter(s)", r.Name, len(params)-used)
+	}
+	return strings.Join(segments, routing.KeySeparator), nil
+}
+
+// Binding fills the key template's leading placeholders with params and
+// matches any remaining ones with the "*" wildcard.
+func (r Route[T]) Binding(params ...string) (string, error) {
+	segments := strings.Split(r.Key, routing.KeySeparator)
+	used := 0
+	for i, segment := range segments {
+		if !isPlaceholder(segment) {
+			continue
+		}
+		if used < len(params) {
+			if err := routing.ValidateSegment(params[used]); err != nil {
+				return "", fmt.Errorf("route %s: %s: %w", r.Name, segment, err)
+			}
+			segments[i] = params[used]
+			used++
+		} else {
+			segments[i] = "*"
+		}
+	}
+	if used != len(params) {
+		return "", fmt.Errorf("route %s: %d unused binding parameter(s)", r.Name, len(params)-used)
+	}
+	return strings.Join(segments, routing.KeySeparator), nil
+}
+
+// Params extracts the placeholder values of a routing key published on the
+// route, keyed by placeholder name, e.g. {"game": "friday"}.
+func (r Route[T]) Params(key string) (map[string]string, error) {
+	template := strings.Split(r.Key, routing.KeySeparator)
+	segments := strings.Split(key, routing.KeySeparator)
+	if len(segments) != len(template) {
+		return nil, fmt.Errorf("route %s: %w: %q does not match %q", r.Name, routing.ErrKeyMismatch, key, r.Key)
+	}
+	params := map[string]string{}
+	for i, segment := range template {
+		if isPlaceholder(segment) {
+			if err := routing.ValidateSegment(segments[i]); err != nil {
+				return nil, fmt.Errorf("route %s: %s: %w", r.Name, segment, err)
+			}
+			params[strings.Trim(segment, "{}")] = segments[i]
+		} else if segments[i] != segment {
+			return nil, fmt.Errorf("route %s: %w: %q does not match %q", r.Name, routing.ErrKeyMismatch, key, r.Key)
+		}
+	}
+	return params, nil
+}
+
+// isPlaceholder reports whether a key template segment is a "{name}" placeholder.
+func isPlaceholder(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// PublishRoute encodes val with the route's codec and publishes it under the
+// route's routing key filled in with params.
+func PublishRoute[T any](t Transport, r Route[T], val T, params ...string) error {
+	key, err := r.RoutingKey(params...)
+	if err != nil {
+		return err
+	}
+	return Publish(t, r.Exchange, key, val, r.Codec)
+}
+
+// SubscribeRoute consumes queueName, bound to the route with its placeholders
+// filled in with params and any remaining ones matched by wildcards.
+func SubscribeRoute[T any](t Transport, r Route[T], queueName string, handler func(T) AckType, params ...string) error {
+	binding, err := r.Binding(params...)
+	if err != nil {
+		return err
+	}
+	return Subscribe(t, r.Exchange, queueName, binding, r.Queue, handler, r.Codec)
+}
+
+// SubscribeRouteParams is SubscribeRoute for handlers that need the
+// placeholder values each message was published with, such as the game of a
+// subscription bound across every game. Messages whose key does not match the
+// route are discarded.
+func SubscribeRouteParams[T any](
+	t Transport,
+	r Route[T],
+	queueName string,
+	handler func(T, map[string]string) AckType,
+	params ...string,
+) error {
+	binding, err := r.Binding(params...)
+	if err != nil {
+		return err
+	}
+	return subscribe(t, r.Exchange, queueName, binding, r.Queue, func(val T, msg Message) AckType {
+		keyParams, err := r.Params(msg.RoutingKey)
+		if err != nil {
+			log.Printf("rejecting message: %v", err)
+			return NackDiscard
+		}
+		return handler(val, keyParams)
+	}, r.Codec)
+}
@@ -0,0 +1,160 @@
+package pubsub
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// ContentTypeSealed marks a body encrypted with a SealedCodec
+	ContentTypeSealed = "application/vnd.peril.sealed"
+	// HeaderSealedContentType records the content type of the encrypted payload
+	HeaderSealedContentType = "x-peril-sealed-content-type"
+	// HeaderSealedContentEncoding records the content encoding of the encrypted payload
+	HeaderSealedContentEncoding = "x-peril-sealed-content-encoding"
+)
+
+// sealContext domain-separates the AES key derivation.
+const sealContext = "peril-sealed-v1"
+
+var (
+	// ErrNotSealed is returned when decoding a plaintext message with a SealedCodec.
+	ErrNotSealed = errors.New("message is not sealed")
+	// ErrNotRecipient is returned when a sealed message cannot be opened with our key.
+	ErrNotRecipient = errors.New("message is not sealed for this recipient")
+)
+
+// SealedCodec wraps a Codec so that bodies are readable only by one recipient.
+// Each message is encrypted with AES-256-GCM under a key agreed by X25519
+// between a fresh ephemeral key and the recipient's public key.
+type SealedCodec struct {
+	Inner     Codec            // Codec for the plaintext payload
+	Recipient *ecdh.PublicKey  // Key messages are sealed for, needed to Encode
+	Private   *ecdh.PrivateKey // Key messages are opened with, needed to Decode
+}
+
+// SealFor returns a codec that encrypts payloads for recipient.
+func SealFor(inner Codec, recipient *ecdh.PublicKey) SealedCodec {
+	return SealedCodec{Inner: inner, Recipient: recipient}
+}
+
+// OpenWith returns a codec that decrypts payloads sealed for priv's public key.
+func OpenWith(inner Codec, priv *ecdh.PrivateKey) SealedCodec {
+	return SealedCodec{Inner: inner, Private: priv}
+}
+
+// ContentType returns the content type of sealed bodies.
+func (c SealedCodec) ContentType() string {
+	return ContentTypeSealed
+}
+
+// Encode serialises val with the inner codec and seals the result.
+// The body is the ephemeral public key, the GCM nonce and the ciphertext.
+func (c SealedCodec) Encode(val any) (Message, error) {
+	if c.Recipient == nil {
+		return Message{}, errors.New("sealed codec has no recipient key")
+	}
+	plain, err := c.Inner.Encode(val)
+	if err != nil {
+		return Message{}, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return Message{}, fmt.Errorf("could not generate ephemeral key: %w", err)
+	}
+	aead, err := sealAEAD(ephemeral, c.Recipient, ephemeral.PublicKey(), c.Recipient)
+	if err != nil {
+		return Message{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Message{}, fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	body := append(ephemeral.PublicKey().Bytes(), nonce...)
+	body = aead.Seal(body, nonce, plain.Body, sealAdditionalData(plain.ContentType, plain.ContentEncoding))
+
+	headers := map[string]string{}
+	for k, v := range plain.Headers {
+		headers[k] = v
+	}
+	headers[HeaderSealedContentType] = plain.ContentType
+	if plain.ContentEncoding != "" {
+		headers[HeaderSealedContentEncoding] = plain.ContentEncoding
+	}
+	return Message{
+		ContentType: ContentTypeSealed,
+		Headers:     headers,
+		Body:        body,
+	}, nil
+}
+
+// Decode opens a sealed body and deserialises it with the inner codec.
+func (c SealedCodec) Decode(msg Message, target any) error {
+	if c.Private == nil {
+		return errors.New("sealed codec has no private key")
+	}
+	if msg.ContentType != ContentTypeSealed {
+		return ErrNotSealed
+	}
+	const keySize = 32
+	if len(msg.Body) < keySize {
+		return ErrNotRecipient
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(msg.Body[:keySize])
+	if err != nil {
+		return fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	aead, err := sealAEAD(c.Private, ephemeral, ephemeral, c.Private.PublicKey())
+	if err != nil {
+		return err
+	}
+	rest := msg.Body[keySize:]
+	if len(rest) < aead.NonceSize() {
+		return ErrNotRecipient
+	}
+	innerType := msg.Headers[HeaderSealedContentType]
+	innerEncoding := msg.Headers[HeaderSealedContentEncoding]
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], sealAdditionalData(innerType, innerEncoding))
+	if err != nil {
+		return ErrNotRecipient
+	}
+
+	msg.ContentType = innerType
+	msg.ContentEncoding = innerEncoding
+	msg.Body = plain
+	if msg, err = decompress(msg); err != nil {
+		return err
+	}
+	return c.Inner.Decode(msg, target)
+}
+
+// sealAdditionalData binds the inner content headers to the ciphertext.
+func sealAdditionalData(contentType, contentEncoding string) []byte {
+	return []byte(contentType + "\n" + contentEncoding)
+}
+
+// sealAEAD derives the AES-GCM cipher shared by the ephemeral and recipient keys.
+func sealAEAD(priv *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("could not agree key: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(sealContext))
+	h.Write(shared)
+	h.Write(ephemeral.Bytes())
+	h.Write(recipient.Bytes())
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
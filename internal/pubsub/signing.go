@@ -0,0 +1,132 @@
+package pubsub
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+)
+
+const (
+	// HeaderSigner names the identity whose key signed a message
+	HeaderSigner = "x-peril-signer"
+	// HeaderSignature carries the base64 Ed25519 signature of a message
+	HeaderSignature = "x-peril-signature"
+)
+
+var (
+	// ErrUnsigned is returned when a message carries no signature.
+	ErrUnsigned = errors.New("message is not signed")
+	// ErrUnknownSigner is returned when the signer has no registered key.
+	ErrUnknownSigner = errors.New("message signer is not registered")
+	// ErrBadSignature is returned when a signature does not match the message.
+	ErrBadSignature = errors.New("message signature is invalid")
+)
+
+// Authored is implemented by payloads that name the identity that published them.
+// Subscribers reject signed messages whose signer is not the payload's author.
+type Authored interface {
+	Author() string
+}
+
+// Sign returns a copy of msg carrying the signer's identity and signature
+// over the routing key, content headers, payload version and body.
+func Sign(key string, msg Message, signer string, priv ed25519.PrivateKey) Message {
+	headers := make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderSigner] = signer
+	sig := ed25519.Sign(priv, signingPayload(key, signer, msg))
+	headers[HeaderSignature] = base64.StdEncoding.EncodeToString(sig)
+	msg.Headers = headers
+	return msg
+}
+
+// Verify checks the signature on a received message and returns its signer.
+func Verify(msg Message, keys *Keyring) (string, error) {
+	signer, ok := msg.Headers[HeaderSigner]
+	if !ok {
+		return "", ErrUnsigned
+	}
+	encoded, ok := msg.Headers[HeaderSignature]
+	if !ok {
+		return "", ErrUnsigned
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	pub, ok := keys.Lookup(signer)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownSigner, signer)
+	}
+	if !ed25519.Verify(pub, signingPayload(msg.RoutingKey, signer, msg), sig) {
+		return "", fmt.Errorf("%w: %s", ErrBadSignature, signer)
+	}
+	return signer, nil
+}
+
+// signingPayload serialises the signed parts of a message unambiguously.
+func signingPayload(key, signer string, msg Message) []byte {
+	var b bytes.Buffer
+	for _, field := range []string{key, signer, msg.ContentType, msg.ContentEncoding, msg.Headers[HeaderVersion]} {
+		binary.Write(&b, binary.BigEndian, uint32(len(field)))
+		b.WriteString(field)
+	}
+	b.Write(msg.Body)
+	return b.Bytes()
+}
+
+// SignedTransport wraps a Transport so that every published message is signed
+// and every consumed message must carry a valid signature from a known key.
+// Messages that fail verification are dead-lettered before reaching handlers.
+type SignedTransport struct {
+	Transport
+	signer string
+	priv   ed25519.PrivateKey
+	keys   *Keyring
+}
+
+// NewSignedTransport signs as signer with priv and verifies against keys.
+func NewSignedTransport(inner Transport, signer string, priv ed25519.PrivateKey, keys *Keyring) *SignedTransport {
+	return &SignedTransport{Transport: inner, signer: signer, priv: priv, keys: keys}
+}
+
+// Publish signs msg and publishes it on the wrapped transport.
+func (t *SignedTransport) Publish(exchange, key string, msg Message) error {
+	return t.Transport.Publish(exchange, key, Sign(key, msg, t.signer, t.priv))
+}
+
+// Subscribe consumes the queue, passing only verified messages to handler.
+func (t *SignedTransport) Subscribe(
+	exchange, // Exchange name to bind to
+	queueName, // Queue name to create/consume from
+	key string, // Routing key for binding
+	queueType SimpleQueueType, // Queue persistence type
+	handler func(Message) AckType, // Message handler function
+) error {
+	return t.Transport.Subscribe(exchange, queueName, key, queueType, func(msg Message) AckType {
+		if _, err := Verify(msg, t.keys); err != nil {
+			log.Printf("rejecting message on %s: %v", msg.RoutingKey, err)
+			return NackDiscard
+		}
+		return handler(msg)
+	})
+}
+
+// checkAuthor rejects signed payloads whose declared author is not the signer.
+func checkAuthor(payload any, msg Message) error {
+	a, ok := payload.(Authored)
+	if !ok {
+		return nil
+	}
+	signer, signed := msg.Headers[HeaderSigner]
+	if !signed || a.Author() == signer {
+		return nil
+	}
+	return fmt.Errorf("payload authored by %q was signed by %q", a.Author(), signer)
+}
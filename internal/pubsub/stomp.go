@@ -0,0 +1,450 @@
+package pubsub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StompAckMode selects how messages delivered on a subscription are acknowledged.
+type StompAckMode string
+
+const (
+	// StompAckAuto treats messages as acknowledged as soon as they are sent
+	StompAckAuto StompAckMode = "auto"
+	// StompAckClient acknowledges all messages up to and including the acked one
+	StompAckClient StompAckMode = "client"
+	// StompAckClientIndividual acknowledges messages one at a time
+	StompAckClientIndividual StompAckMode = "client-individual"
+)
+
+const defaultReceiptTimeout = 5 * time.Second
+
+// ErrStompClosed is returned by operations on a closed STOMP connection.
+var ErrStompClosed = errors.New("stomp connection closed")
+
+// StompOptions configures a STOMP connection.
+type StompOptions struct {
+	Login          string        // Login header sent on CONNECT
+	Passcode       string        // Passcode header sent on CONNECT
+	VirtualHost    string        // Host header sent on CONNECT, "/" for RabbitMQ's default vhost
+	HeartBeat      time.Duration // Desired heart-beat interval in both directions, zero disables
+	Receipts       bool          // Wait for a RECEIPT on every SEND, SUBSCRIBE and UNSUBSCRIBE
+	ReceiptTimeout time.Duration // How long to wait for a RECEIPT, defaults to five seconds
+}
+
+// StompConn is a STOMP 1.2 client connection.
+type StompConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	opts StompOptions
+
+	wmu sync.Mutex // Serializes frame writes
+	w   *bufio.Writer
+
+	mu       sync.Mutex
+	subs     map[string]*StompSubscription
+	receipts map[string]chan struct{}
+	nextID   int
+	err      error
+	done     chan struct{}
+
+	sendBeat time.Duration // Negotiated interval for outgoing heart-beats
+	recvBeat time.Duration // Negotiated interval for incoming heart-beats
+}
+
+// StompSubscription is an active SUBSCRIBE on a STOMP connection.
+type StompSubscription struct {
+	ID          string       // Subscription identifier sent to the broker
+	Destination string       // Subscribed destination
+	Mode        StompAckMode // Acknowledgement mode of the subscription
+
+	conn    *StompConn
+	mu      sync.Mutex
+	pending []Frame       // Messages received but not yet handled, oldest first
+	ready   chan struct{} // Signalled when pending gains a message
+	stop    chan struct{}
+}
+
+// DialStomp connects to the STOMP broker at addr and performs the CONNECT handshake.
+func DialStomp(addr string, opts StompOptions) (*StompConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to STOMP server %s: %w", addr, err)
+	}
+	c, err := NewStompConn(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewStompConn performs the CONNECT handshake over an established network connection.
+func NewStompConn(conn net.Conn, opts StompOptions) (*StompConn, error) {
+	if opts.ReceiptTimeout == 0 {
+		opts.ReceiptTimeout = defaultReceiptTimeout
+	}
+	if opts.VirtualHost == "" {
+		opts.VirtualHost = "/"
+	}
+
+	c := &StompConn{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		w:        bufio.NewWriter(conn),
+		opts:     opts,
+		subs:     map[string]*StompSubscription{},
+		receipts: map[string]chan struct{}{},
+		done:     make(chan struct{}),
+	}
+
+	beat := strconv.FormatInt(opts.HeartBeat.Milliseconds(), 10)
+	connect := NewFrame(StompConnect,
+		"accept-version", "1.2",
+		"host", opts.VirtualHost,
+		"heart-beat", beat+","+beat,
+	)
+	if opts.Login != "" {
+		connect.Set("login", opts.Login)
+		connect.Set("passcode", opts.Passcode)
+	}
+	if err := c.write(connect); err != nil {
+		return nil, fmt.Errorf("could not send CONNECT: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(opts.ReceiptTimeout))
+	var reply Frame
+	for reply.Command == "" {
+		f, err := ReadFrame(c.r)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CONNECTED: %w", err)
+		}
+		reply = f
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	switch reply.Command {
+	case StompConnected:
+	case StompError:
+		return nil, fmt.Errorf("stomp server refused connection: %s", reply.Get("message"))
+	default:
+		return nil, fmt.Errorf("unexpected %s frame in response to CONNECT", reply.Command)
+	}
+	if v := reply.Get("version"); v != "1.2" {
+		return nil, fmt.Errorf("unsupported STOMP version %q", v)
+	}
+
+	sx, sy := ParseHeartBeat(reply.Get("heart-beat"))
+	c.sendBeat = negotiateHeartBeat(opts.HeartBeat, sy)
+	c.recvBeat = negotiateHeartBeat(opts.HeartBeat, sx)
+
+	go c.readLoop()
+	if c.sendBeat > 0 {
+		go c.heartBeatLoop()
+	}
+	return c, nil
+}
+
+// Send publishes body to destination with the given extra headers.
+func (c *StompConn) Send(destination string, headers map[string]string, body []byte) error {
+	f := NewFrame(StompSend, "destination", destination)
+	for k, v := range headers {
+		f.Set(k, v)
+	}
+	f.Body = body
+	return c.request(f, c.opts.Receipts)
+}
+
+// Subscribe starts consuming destination. Each MESSAGE frame is passed to
+// handler on a goroutine dedicated to the subscription, in delivery order.
+func (c *StompConn) Subscribe(
+	destination string,
+	mode StompAckMode,
+	headers map[string]string,
+	handler func(Frame),
+) (*StompSubscription, error) {
+	c.mu.Lock()
+	c.nextID++
+	sub := &StompSubscription{
+		ID:          "sub-" + strconv.Itoa(c.nextID),
+		Destination: destination,
+		Mode:        mode,
+		conn:        c,
+		ready:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	c.subs[sub.ID] = sub
+	c.mu.Unlock()
+
+	f := NewFrame(StompSubscribe, "id", sub.ID, "destination", destination, "ack", string(mode))
+	for k, v := range headers {
+		f.Set(k, v)
+	}
+	if err := c.request(f, c.opts.Receipts); err != nil {
+		c.removeSubscription(sub.ID)
+		return nil, fmt.Errorf("could not subscribe to %s: %w", destination, err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-sub.ready:
+			case <-sub.stop:
+				return
+			}
+			for m, ok := sub.next(); ok; m, ok = sub.next() {
+				select {
+				case <-sub.stop:
+					return
+				default:
+				}
+				handler(m)
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// deliver queues a MESSAGE frame for the handler without blocking, so the
+// read loop keeps dispatching receipts while a handler waits on one.
+func (s *StompSubscription) deliver(f Frame) {
+	s.mu.Lock()
+	s.pending = append(s.pending, f)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the oldest queued message, if any.
+func (s *StompSubscription) next() (Frame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return Frame{}, false
+	}
+	f := s.pending[0]
+	s.pending[0] = Frame{}
+	s.pending = s.pending[1:]
+	return f, true
+}
+
+// Unsubscribe stops the subscription and its handler goroutine.
+func (s *StompSubscription) Unsubscribe() error {
+	err := s.conn.request(NewFrame(StompUnsubscribe, "id", s.ID), s.conn.opts.Receipts)
+	s.conn.removeSubscription(s.ID)
+	return err
+}
+
+// Ack acknowledges a MESSAGE frame received on a client or client-individual subscription.
+func (c *StompConn) Ack(msg Frame) error {
+	return c.write(NewFrame(StompAck, "id", msg.Get("ack")))
+}
+
+// Nack rejects a MESSAGE frame. When requeue is false the broker is asked to
+// dead-letter the message instead of redelivering it.
+func (c *StompConn) Nack(msg Frame, requeue bool) error {
+	f := NewFrame(StompNack, "id", msg.Get("ack"))
+	if !requeue {
+		f.Set("requeue", "false")
+	}
+	return c.write(f)
+}
+
+// Disconnect gracefully closes the connection once the broker has confirmed
+// that every previously sent frame was received.
+func (c *StompConn) Disconnect() error {
+	err := c.request(NewFrame(StompDisconnect), true)
+	c.fail(ErrStompClosed)
+	if errors.Is(err, ErrStompClosed) {
+		return nil
+	}
+	return err
+}
+
+// Done is closed when the connection terminates.
+func (c *StompConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection terminated, or nil while it is open.
+func (c *StompConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// request writes f, optionally waiting for the broker to confirm it with a RECEIPT.
+func (c *StompConn) request(f Frame, receipt bool) error {
+	if !receipt {
+		return c.write(f)
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := "receipt-" + strconv.Itoa(c.nextID)
+	ch := make(chan struct{})
+	c.receipts[id] = ch
+	c.mu.Unlock()
+
+	f.Set("receipt", id)
+	if err := c.write(f); err != nil {
+		c.forgetReceipt(id)
+		return err
+	}
+
+	timer := time.NewTimer(c.opts.ReceiptTimeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-c.done:
+		c.forgetReceipt(id)
+		return c.Err()
+	case <-timer.C:
+		c.forgetReceipt(id)
+		return fmt.Errorf("timed out waiting for receipt of %s", f.Command)
+	}
+}
+
+// forgetReceipt stops waiting for a receipt that will not be awaited.
+func (c *StompConn) forgetReceipt(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.receipts, id)
+}
+
+// write encodes a single frame onto the connection.
+func (c *StompConn) write(f Frame) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := f.WriteTo(c.w); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// readLoop dispatches incoming frames until the connection fails.
+func (c *StompConn) readLoop() {
+	for {
+		if c.recvBeat > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(2 * c.recvBeat))
+		}
+		f, err := ReadFrame(c.r)
+		if err != nil {
+			c.fail(fmt.Errorf("stomp read failed: %w", err))
+			return
+		}
+
+		switch f.Command {
+		case "":
+			// heart-beat
+		case StompMessage:
+			c.mu.Lock()
+			sub, ok := c.subs[f.Get("subscription")]
+			c.mu.Unlock()
+			if ok {
+				sub.deliver(f)
+			}
+		case StompReceipt:
+			c.mu.Lock()
+			if ch, ok := c.receipts[f.Get("receipt-id")]; ok {
+				close(ch)
+				delete(c.receipts, f.Get("receipt-id"))
+			}
+			c.mu.Unlock()
+		case StompError:
+			c.fail(fmt.Errorf("stomp server error: %s: %s", f.Get("message"), f.Body))
+			return
+		}
+	}
+}
+
+// heartBeatLoop sends an end-of-line at the negotiated interval.
+func (c *StompConn) heartBeatLoop() {
+	ticker := time.NewTicker(c.sendBeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.wmu.Lock()
+			c.conn.SetWriteDeadline(time.Now().Add(c.sendBeat))
+			_, err := c.w.WriteString("\n")
+			if err == nil {
+				err = c.w.Flush()
+			}
+			c.conn.SetWriteDeadline(time.Time{})
+			c.wmu.Unlock()
+			if err != nil {
+				c.fail(fmt.Errorf("stomp heart-beat failed: %w", err))
+				return
+			}
+		}
+	}
+}
+
+// fail records the first terminal error and tears the connection down.
+func (c *StompConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+	for id, sub := range c.subs {
+		close(sub.stop)
+		delete(c.subs, id)
+	}
+}
+
+// removeSubscription forgets a subscription and ends its handler goroutine.
+func (c *StompConn) removeSubscription(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sub, ok := c.subs[id]; ok {
+		close(sub.stop)
+		delete(c.subs, id)
+	}
+}
+
+// ParseHeartBeat parses a "cx,cy" heart-beat header into durations. Malformed
+// headers are treated as declining heart-beats.
+func ParseHeartBeat(h string) (time.Duration, time.Duration) {
+	x, y, ok := strings.Cut(h, ",")
+	if !ok {
+		return 0, 0
+	}
+	cx, err1 := strconv.Atoi(x)
+	cy, err2 := strconv.Atoi(y)
+	if err1 != nil || err2 != nil {
+		return 0, 0
+	}
+	return time.Duration(cx) * time.Millisecond, time.Duration(cy) * time.Millisecond
+}
+
+// negotiateHeartBeat applies the STOMP rule: no heart-beats if either side
+// declines, otherwise the larger of the two intervals.
+func negotiateHeartBeat(ours, theirs time.Duration) time.Duration {
+	if ours <= 0 || theirs <= 0 {
+		return 0
+	}
+	return max(ours, theirs)
+}
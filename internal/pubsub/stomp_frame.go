@@ -0,0 +1,241 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// STOMP 1.2 frame commands.
+const (
+	StompConnect     = "CONNECT"
+	StompStomp       = "STOMP"
+	StompConnected   = "CONNECTED"
+	StompSend        = "SEND"
+	StompSubscribe   = "SUBSCRIBE"
+	StompUnsubscribe = "UNSUBSCRIBE"
+	StompAck         = "ACK"
+	StompNack        = "NACK"
+	StompDisconnect  = "DISCONNECT"
+	StompMessage     = "MESSAGE"
+	StompReceipt     = "RECEIPT"
+	StompError       = "ERROR"
+)
+
+const (
+	// maxFrameBody bounds the body size accepted by ReadFrame.
+	maxFrameBody = 16 << 20
+	// maxFrameLine bounds the command and header lines accepted by ReadFrame.
+	maxFrameLine = 64 << 10
+)
+
+// errFrameTooLarge is returned by ReadFrame for frames over its limits.
+var errFrameTooLarge = errors.New("frame too large")
+
+// Frame is a single STOMP frame: a command, ordered headers and a body.
+type Frame struct {
+	Command string      // Frame command, e.g. SEND or MESSAGE
+	Headers [][2]string // Header key/value pairs in wire order
+	Body    []byte      // Frame body
+}
+
+// NewFrame creates a frame with the given command and alternating header keys and values.
+func NewFrame(command string, headers ...string) Frame {
+	f := Frame{Command: command}
+	for i := 0; i+1 < len(headers); i += 2 {
+		f.Set(headers[i], headers[i+1])
+	}
+	return f
+}
+
+// Get returns the first value of header key. Per STOMP 1.2 repeated headers
+// are allowed and only the first occurrence is significant.
+func (f Frame) Get(key string) string {
+	v, _ := f.Lookup(key)
+	return v
+}
+
+// Lookup returns the first value of header key and whether it was present.
+func (f Frame) Lookup(key string) (string, bool) {
+	for _, h := range f.Headers {
+		if h[0] == key {
+			return h[1], true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of header key, adding it if it is missing.
+func (f *Frame) Set(key, value string) {
+	for i, h := range f.Headers {
+		if h[0] == key {
+			f.Headers[i][1] = value
+			return
+		}
+	}
+	f.Headers = append(f.Headers, [2]string{key, value})
+}
+
+// WriteTo encodes the frame to w in STOMP 1.2 wire format.
+func (f Frame) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	escape := f.Command != StompConnect && f.Command != StompConnected
+	buf.WriteString(f.Command)
+	buf.WriteByte('\n')
+	for _, h := range f.Headers {
+		if h[0] == "content-length" {
+			continue
+		}
+		buf.WriteString(encodeHeader(h[0], escape))
+		buf.WriteByte(':')
+		buf.WriteString(encodeHeader(h[1], escape))
+		buf.WriteByte('\n')
+	}
+	if len(f.Body) > 0 {
+		buf.WriteString("content-length:" + strconv.Itoa(len(f.Body)) + "\n")
+	}
+	buf.WriteByte('\n')
+	buf.Write(f.Body)
+	buf.WriteByte(0)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// ReadFrame reads the next frame from r. Heart-beat end-of-lines between
+// frames are consumed and reported as a frame with an empty command.
+func ReadFrame(r *bufio.Reader) (Frame, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return Frame{}, err
+	}
+	if line == "" {
+		return Frame{}, nil
+	}
+
+	f := Frame{Command: line}
+	unescape := f.Command != StompConnect && f.Command != StompConnected
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return Frame{}, err
+		}
+		if line == "" {
+			break
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return Frame{}, fmt.Errorf("malformed header %q", line)
+		}
+		if unescape {
+			if k, err = decodeHeader(k); err != nil {
+				return Frame{}, err
+			}
+			if v, err = decodeHeader(v); err != nil {
+				return Frame{}, err
+			}
+		}
+		f.Headers = append(f.Headers, [2]string{k, v})
+	}
+
+	if cl, ok := f.Lookup("content-length"); ok {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < 0 || n > maxFrameBody {
+			return Frame{}, fmt.Errorf("invalid content-length %q", cl)
+		}
+		f.Body = make([]byte, n)
+		if _, err := io.ReadFull(r, f.Body); err != nil {
+			return Frame{}, err
+		}
+		nul, err := r.ReadByte()
+		if err != nil {
+			return Frame{}, err
+		}
+		if nul != 0 {
+			return Frame{}, errors.New("frame body not terminated by NUL")
+		}
+		return f, nil
+	}
+
+	body, err := readUntil(r, 0, maxFrameBody)
+	if err != nil {
+		return Frame{}, err
+	}
+	f.Body = body[:len(body)-1]
+	return f, nil
+}
+
+// readLine reads a line terminated by LF or CRLF without the terminator.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := readUntil(r, '\n', maxFrameLine)
+	if err != nil {
+		return "", err
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+}
+
+// readUntil reads up to and including delim, failing with errFrameTooLarge
+// as soon as more than limit bytes come before it, so a peer that never
+// sends delim can not make it buffer without bound.
+func readUntil(r *bufio.Reader, delim byte, limit int) ([]byte, error) {
+	var out []byte
+	for {
+		chunk, err := r.ReadSlice(delim)
+		if len(out)+len(chunk) > limit+1 {
+			return nil, errFrameTooLarge
+		}
+		out = append(out, chunk...)
+		switch {
+		case err == nil:
+			return out, nil
+		case !errors.Is(err, bufio.ErrBufferFull):
+			return nil, err
+		}
+	}
+}
+
+var headerEscaper = strings.NewReplacer(`\`, `\\`, "\r", `\r`, "\n", `\n`, ":", `\c`)
+
+// encodeHeader escapes a header key or value for the wire.
+func encodeHeader(s string, escape bool) string {
+	if !escape {
+		return s
+	}
+	return headerEscaper.Replace(s)
+}
+
+// decodeHeader reverses encodeHeader, rejecting undefined escape sequences.
+func decodeHeader(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("invalid escape at end of header %q", s)
+		}
+		switch s[i] {
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		case 'c':
+			b.WriteByte(':')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in header %q", s[i], s)
+		}
+	}
+	return b.String(), nil
+}
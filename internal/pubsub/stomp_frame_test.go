@@ -0,0 +1,65 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// endless reads as the same byte forever.
+type endless byte
+
+func (e endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(e)
+	}
+	return len(p), nil
+}
+
+func TestReadFrameRoundTrip(t *testing.T) {
+	f := NewFrame(StompSend, "destination", "/queue/a:b", "x-note", "line\nbreak")
+	f.Body = []byte("hello")
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("could not write frame: %v", err)
+	}
+	got, err := ReadFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("could not read frame: %v", err)
+	}
+	if got.Command != StompSend || got.Get("destination") != "/queue/a:b" || got.Get("x-note") != "line\nbreak" || string(got.Body) != "hello" {
+		t.Errorf("read %+v, want %+v", got, f)
+	}
+}
+
+func TestReadFrameRejectsUnterminatedBody(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("SEND\ndestination:/queue/a\n\n"), endless('a'))
+	if _, err := ReadFrame(bufio.NewReader(r)); !errors.Is(err, errFrameTooLarge) {
+		t.Errorf("reading an endless body returned %v, want %v", err, errFrameTooLarge)
+	}
+}
+
+func TestReadFrameRejectsEndlessLine(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("SEND\ndestination:"), endless('a'))
+	if _, err := ReadFrame(bufio.NewReader(r)); !errors.Is(err, errFrameTooLarge) {
+		t.Errorf("reading an endless header returned %v, want %v", err, errFrameTooLarge)
+	}
+}
+
+func TestReadFrameAcceptsBodyAtLimit(t *testing.T) {
+	r := io.MultiReader(
+		strings.NewReader("SEND\n\n"),
+		io.LimitReader(endless('a'), maxFrameBody),
+		strings.NewReader("\x00"),
+	)
+	f, err := ReadFrame(bufio.NewReader(r))
+	if err != nil {
+		t.Fatalf("could not read a body of the largest size: %v", err)
+	}
+	if len(f.Body) != maxFrameBody {
+		t.Errorf("body has %d bytes, want %d", len(f.Body), maxFrameBody)
+	}
+}
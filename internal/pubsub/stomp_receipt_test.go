@@ -0,0 +1,63 @@
+package pubsub
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// silentServer accepts a STOMP connection over a pipe and then swallows
+// every frame without answering.
+func silentServer(t *testing.T) (*StompConn, net.Conn) {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		r := bufio.NewReader(server)
+		if _, err := ReadFrame(r); err != nil {
+			return
+		}
+		if _, err := NewFrame(StompConnected, "version", "1.2").WriteTo(server); err != nil {
+			return
+		}
+		io.Copy(io.Discard, r)
+	}()
+	c, err := NewStompConn(client, StompOptions{Receipts: true, ReceiptTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return c, server
+}
+
+func pendingReceipts(c *StompConn) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.receipts)
+}
+
+func TestReceiptForgottenOnTimeout(t *testing.T) {
+	c, _ := silentServer(t)
+	if err := c.Send("/queue/test", nil, []byte("hello")); err == nil {
+		t.Fatal("send without a receipt succeeded")
+	}
+	if n := pendingReceipts(c); n != 0 {
+		t.Errorf("%d receipts still awaited after timing out", n)
+	}
+}
+
+func TestReceiptForgottenOnWriteError(t *testing.T) {
+	c, server := silentServer(t)
+	server.Close()
+	<-c.Done()
+	c.mu.Lock()
+	c.err = nil // Let request get as far as writing
+	c.mu.Unlock()
+	if err := c.Send("/queue/test", nil, []byte("hello")); err == nil {
+		t.Fatal("send on a closed connection succeeded")
+	}
+	if n := pendingReceipts(c); n != 0 {
+		t.Errorf("%d receipts still awaited after a failed write", n)
+	}
+}
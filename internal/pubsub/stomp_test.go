@@ -0,0 +1,224 @@
+package pubsub_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub/stomptest"
+)
+
+const testDestination = "/exchange/peril_topic/army_moves.*"
+
+func newServer(t *testing.T) *stomptest.Server {
+	t.Helper()
+	srv, err := stomptest.NewServer()
+	if err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func dial(t *testing.T, srv *stomptest.Server, opts pubsub.StompOptions) *pubsub.StompConn {
+	t.Helper()
+	conn, err := pubsub.DialStomp(srv.Addr(), opts)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Disconnect() })
+	return conn
+}
+
+func receive(t *testing.T, ch <-chan pubsub.Frame) pubsub.Frame {
+	t.Helper()
+	select {
+	case f := <-ch:
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return pubsub.Frame{}
+	}
+}
+
+func TestStompPublishSubscribe(t *testing.T) {
+	srv := newServer(t)
+	conn := dial(t, srv, pubsub.StompOptions{})
+
+	got := make(chan pubsub.Frame, 1)
+	if _, err := conn.Subscribe(testDestination, pubsub.StompAckAuto, nil, func(f pubsub.Frame) {
+		got <- f
+	}); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if err := conn.Send("/exchange/peril_topic/army_moves.bob", map[string]string{"x-game": "g1"}, []byte("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+
+	f := receive(t, got)
+	if string(f.Body) != "hello" {
+		t.Errorf("body = %q, want %q", f.Body, "hello")
+	}
+	if h := f.Get("x-game"); h != "g1" {
+		t.Errorf("x-game header = %q, want %q", h, "g1")
+	}
+}
+
+func TestStompAckNack(t *testing.T) {
+	srv := newServer(t)
+	conn := dial(t, srv, pubsub.StompOptions{})
+
+	got := make(chan pubsub.Frame, 2)
+	if _, err := conn.Subscribe(testDestination, pubsub.StompAckClientIndividual, nil, func(f pubsub.Frame) {
+		if f.Get("redelivered") == "true" {
+			conn.Ack(f)
+		} else {
+			conn.Nack(f, true)
+		}
+		got <- f
+	}); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if err := conn.Send("/exchange/peril_topic/army_moves.bob", nil, []byte("move")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+
+	first, second := receive(t, got), receive(t, got)
+	if first.Get("ack") == "" {
+		t.Error("client-individual message has no ack header")
+	}
+	if second.Get("redelivered") != "true" {
+		t.Error("nacked message was not redelivered")
+	}
+
+	if err := conn.Disconnect(); err != nil {
+		t.Fatalf("could not disconnect: %v", err)
+	}
+	if n := len(srv.FramesWithCommand(pubsub.StompNack)); n != 1 {
+		t.Errorf("server got %d NACK frames, want 1", n)
+	}
+	acks := srv.FramesWithCommand(pubsub.StompAck)
+	if len(acks) != 1 || acks[0].Get("id") != second.Get("ack") {
+		t.Errorf("server got ACK frames %v, want one for %s", acks, second.Get("ack"))
+	}
+}
+
+func TestStompReceipts(t *testing.T) {
+	srv := newServer(t)
+	conn := dial(t, srv, pubsub.StompOptions{Receipts: true})
+
+	sub, err := conn.Subscribe(testDestination, pubsub.StompAckAuto, nil, func(pubsub.Frame) {})
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if err := conn.Send("/exchange/peril_topic/army_moves.bob", nil, []byte("move")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("could not unsubscribe: %v", err)
+	}
+
+	for _, command := range []string{pubsub.StompSubscribe, pubsub.StompSend, pubsub.StompUnsubscribe} {
+		frames := srv.FramesWithCommand(command)
+		if len(frames) != 1 || frames[0].Get("receipt") == "" {
+			t.Errorf("%s frames %v, want one asking for a receipt", command, frames)
+		}
+	}
+}
+
+// TestStompReceiptsFromHandler publishes with receipts from a handler while
+// many more messages than a subscription buffers are arriving, which must not
+// hold up the receipts the handler waits for.
+func TestStompReceiptsFromHandler(t *testing.T) {
+	const messages = 200
+
+	srv := newServer(t)
+	conn := dial(t, srv, pubsub.StompOptions{Receipts: true, ReceiptTimeout: time.Second})
+	publisher := dial(t, srv, pubsub.StompOptions{})
+
+	var (
+		mu      sync.Mutex
+		handled int
+		errs    []error
+	)
+	done := make(chan struct{})
+	if _, err := conn.Subscribe(testDestination, pubsub.StompAckAuto, nil, func(f pubsub.Frame) {
+		err := conn.Send("/exchange/peril_topic/war.bob", nil, f.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		handled++
+		if handled == messages {
+			close(done)
+		}
+	}); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	for i := range messages {
+		if err := publisher.Send("/exchange/peril_topic/army_moves.bob", nil, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler did not get through every message")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) > 0 {
+		t.Fatalf("handler sends failed: %v", errs[0])
+	}
+}
+
+func TestStompHeartBeat(t *testing.T) {
+	srv := newServer(t)
+	srv.HeartBeat = 20 * time.Millisecond
+	conn := dial(t, srv, pubsub.StompOptions{HeartBeat: 20 * time.Millisecond})
+
+	select {
+	case <-conn.Done():
+		t.Fatalf("connection with heart-beats failed: %v", conn.Err())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestStompHeartBeatTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		r := bufio.NewReader(server)
+		if _, err := pubsub.ReadFrame(r); err != nil {
+			return
+		}
+		connected := pubsub.NewFrame(pubsub.StompConnected, "version", "1.2", "heart-beat", "20,20")
+		if _, err := connected.WriteTo(server); err != nil {
+			return
+		}
+		// Swallow the client's heart-beats but never send any back
+		io.Copy(io.Discard, r)
+	}()
+
+	conn, err := pubsub.NewStompConn(client, pubsub.StompOptions{HeartBeat: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection survived a silent server")
+	}
+	if conn.Err() == nil {
+		t.Error("failed connection has no error")
+	}
+}
@@ -0,0 +1,141 @@
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stompFrameHeaders are STOMP-level headers that are not carried over into Message.Headers.
+var stompFrameHeaders = map[string]struct{}{
+	"destination":      {},
+	"subscription":     {},
+	"message-id":       {},
+	"ack":              {},
+	"content-type":     {},
+	"content-length":   {},
+	"content-encoding": {},
+	"redelivered":      {},
+	"persistent":       {},
+	"receipt":          {},
+}
+
+// StompTransport is a Transport that talks STOMP 1.2, using RabbitMQ's
+// /exchange/<name>/<key> destinations to reach the same exchanges as AMQP clients.
+type StompTransport struct {
+	conn *StompConn
+}
+
+// DialStompTransport connects to the STOMP broker at addr and returns a Transport for it.
+func DialStompTransport(addr string, opts StompOptions) (*StompTransport, error) {
+	conn, err := DialStomp(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewStompTransport(conn), nil
+}
+
+// NewStompTransport wraps an established STOMP connection in a Transport.
+func NewStompTransport(conn *StompConn) *StompTransport {
+	return &StompTransport{conn: conn}
+}
+
+// Conn returns the underlying STOMP connection.
+func (t *StompTransport) Conn() *StompConn {
+	return t.conn
+}
+
+// Publish sends msg to the exchange with the given routing key.
+func (t *StompTransport) Publish(exchange, key string, msg Message) error {
+	headers := map[string]string{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	if msg.ContentType != "" {
+		headers["content-type"] = msg.ContentType
+	}
+	if msg.ContentEncoding != "" {
+		headers["content-encoding"] = msg.ContentEncoding
+	}
+	return t.conn.Send(ExchangeDestination(exchange, key), headers, msg.Body)
+}
+
+// Subscribe binds a named queue to the exchange through a SUBSCRIBE frame and
+// consumes it with client-individual acknowledgements.
+func (t *StompTransport) Subscribe(
+	exchange, // Exchange name to bind to
+	queueName, // Queue name to create/consume from
+	key string, // Routing key for binding
+	queueType SimpleQueueType, // Queue persistence type
+	handler func(Message) AckType, // Message handler function
+) error {
+	headers := map[string]string{
+		"x-queue-name":           queueName,
+		"x-dead-letter-exchange": DeadLetterExchange,
+	}
+	switch queueType {
+	case SimpleQueueDurable:
+		headers["durable"] = "true"
+		headers["auto-delete"] = "false"
+	case SimpleQueueTransient:
+		headers["durable"] = "false"
+		headers["auto-delete"] = "true"
+		headers["exclusive"] = "true"
+	default:
+		return fmt.Errorf("invalid queue type: %v", queueType)
+	}
+
+	_, err := t.conn.Subscribe(ExchangeDestination(exchange, key), StompAckClientIndividual, headers, func(f Frame) {
+		settle(messageFromFrame(f), stompAcknowledger{t.conn, f}, handler)
+	})
+	return err
+}
+
+// Close disconnects from the broker.
+func (t *StompTransport) Close() error {
+	return t.conn.Disconnect()
+}
+
+// ExchangeDestination returns the STOMP destination addressing an exchange with a routing key.
+func ExchangeDestination(exchange, key string) string {
+	return "/exchange/" + exchange + "/" + key
+}
+
+// stompAcknowledger settles a STOMP MESSAGE frame.
+type stompAcknowledger struct {
+	conn  *StompConn
+	frame Frame
+}
+
+func (a stompAcknowledger) ack() error {
+	return a.conn.Ack(a.frame)
+}
+
+func (a stompAcknowledger) nack(requeue bool) error {
+	return a.conn.Nack(a.frame, requeue)
+}
+
+// messageFromFrame converts a MESSAGE frame into a Message.
+func messageFromFrame(f Frame) Message {
+	headers := map[string]string{}
+	for _, h := range f.Headers {
+		if _, ok := stompFrameHeaders[h[0]]; ok {
+			continue
+		}
+		if _, ok := headers[h[0]]; !ok {
+			headers[h[0]] = h[1]
+		}
+	}
+
+	key := f.Get("destination")
+	if rest, ok := strings.CutPrefix(key, "/exchange/"); ok {
+		_, key, _ = strings.Cut(rest, "/")
+	}
+
+	return Message{
+		RoutingKey:      key,
+		ContentType:     f.Get("content-type"),
+		ContentEncoding: f.Get("content-encoding"),
+		Headers:         headers,
+		Body:            f.Body,
+	}
+}
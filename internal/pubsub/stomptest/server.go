@@ -0,0 +1,369 @@
+// Package stomptest provides an in-memory STOMP 1.2 server for exercising
+// STOMP clients without a running RabbitMQ broker.
+package stomptest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// Server is a fake STOMP broker listening on a loopback port. It routes SEND
+// frames to every subscription whose destination matches, understands
+// RabbitMQ-style /exchange/<name>/<pattern> destinations with topic wildcards,
+// shares messages between subscriptions that use the same x-queue-name, and
+// records every frame it receives.
+type Server struct {
+	// HeartBeat is the heart-beat interval the server offers in CONNECTED.
+	// It must be set before the first client connects.
+	HeartBeat time.Duration
+
+	ln net.Listener
+
+	mu       sync.Mutex
+	frames   []pubsub.Frame
+	queues   map[string]*queue
+	sessions map[*session]struct{}
+	nextID   int
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// queue holds the subscriptions consuming one destination or named queue.
+type queue struct {
+	pattern string
+	subs    []*subscription
+	next    int
+}
+
+type subscription struct {
+	id      string
+	session *session
+	ack     pubsub.StompAckMode
+}
+
+type session struct {
+	conn    net.Conn
+	wmu     sync.Mutex
+	w       *bufio.Writer
+	pending map[string]pendingMessage // unacknowledged messages by ack id
+}
+
+type pendingMessage struct {
+	queue *queue
+	frame pubsub.Frame
+}
+
+// NewServer starts a server on a random loopback port.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		queues:   map[string]*queue{},
+		sessions: map[*session]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Frames returns a copy of every frame received so far, heart-beats excluded.
+func (s *Server) Frames() []pubsub.Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pubsub.Frame(nil), s.frames...)
+}
+
+// FramesWithCommand returns the received frames with the given command.
+func (s *Server) FramesWithCommand(command string) []pubsub.Frame {
+	var out []pubsub.Frame
+	for _, f := range s.Frames() {
+		if f.Command == command {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Close stops the server and drops every client connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		sess := &session{conn: conn, w: bufio.NewWriter(conn), pending: map[string]pendingMessage{}}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.sessions[sess] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(sess)
+	}
+}
+
+func (s *Server) serve(sess *session) {
+	defer s.wg.Done()
+	defer s.drop(sess)
+
+	r := bufio.NewReader(sess.conn)
+	for {
+		f, err := pubsub.ReadFrame(r)
+		if err != nil {
+			return
+		}
+		if f.Command == "" {
+			continue
+		}
+		s.mu.Lock()
+		s.frames = append(s.frames, f)
+		s.mu.Unlock()
+
+		if err := s.handle(sess, f); err != nil {
+			sess.write(pubsub.NewFrame(pubsub.StompError, "message", err.Error()))
+			return
+		}
+		if id, ok := f.Lookup("receipt"); ok && f.Command != pubsub.StompConnect {
+			sess.write(pubsub.NewFrame(pubsub.StompReceipt, "receipt-id", id))
+		}
+		if f.Command == pubsub.StompDisconnect {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(sess *session, f pubsub.Frame) error {
+	switch f.Command {
+	case pubsub.StompConnect, pubsub.StompStomp:
+		if !strings.Contains(f.Get("accept-version"), "1.2") {
+			return errors.New("only STOMP 1.2 is supported")
+		}
+		_, cy := pubsub.ParseHeartBeat(f.Get("heart-beat"))
+		offer := s.HeartBeat.Milliseconds()
+		if cy > 0 && s.HeartBeat > 0 {
+			go sess.heartBeat(max(cy, s.HeartBeat))
+		}
+		return sess.write(pubsub.NewFrame(pubsub.StompConnected,
+			"version", "1.2",
+			"heart-beat", strconv.FormatInt(offer, 10)+","+strconv.FormatInt(offer, 10),
+			"server", "stomptest",
+		))
+	case pubsub.StompSubscribe:
+		return s.subscribe(sess, f)
+	case pubsub.StompUnsubscribe:
+		s.unsubscribe(sess, f.Get("id"))
+	case pubsub.StompSend:
+		s.send(f)
+	case pubsub.StompAck:
+		s.mu.Lock()
+		delete(sess.pending, f.Get("id"))
+		s.mu.Unlock()
+	case pubsub.StompNack:
+		s.mu.Lock()
+		p, ok := sess.pending[f.Get("id")]
+		delete(sess.pending, f.Get("id"))
+		s.mu.Unlock()
+		if ok && f.Get("requeue") != "false" {
+			p.frame.Set("redelivered", "true")
+			s.deliver(p.queue, p.frame)
+		}
+	case pubsub.StompDisconnect:
+	default:
+		return errors.New("unsupported frame " + f.Command)
+	}
+	return nil
+}
+
+func (s *Server) subscribe(sess *session, f pubsub.Frame) error {
+	dest := f.Get("destination")
+	id := f.Get("id")
+	if dest == "" || id == "" {
+		return errors.New("SUBSCRIBE requires destination and id headers")
+	}
+	mode := pubsub.StompAckMode(f.Get("ack"))
+	if mode == "" {
+		mode = pubsub.StompAckAuto
+	}
+
+	name := f.Get("x-queue-name")
+	if name == "" {
+		s.mu.Lock()
+		s.nextID++
+		name = "stomptest-" + strconv.Itoa(s.nextID)
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[name]
+	if !ok {
+		q = &queue{pattern: dest}
+		s.queues[name] = q
+	}
+	q.subs = append(q.subs, &subscription{id: id, session: sess, ack: mode})
+	return nil
+}
+
+func (s *Server) unsubscribe(sess *session, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range s.queues {
+		for i, sub := range q.subs {
+			if sub.session == sess && sub.id == id {
+				q.subs = append(q.subs[:i], q.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// send routes a SEND frame to every queue whose pattern matches its destination.
+func (s *Server) send(f pubsub.Frame) {
+	dest := f.Get("destination")
+	s.mu.Lock()
+	var targets []*queue
+	for _, q := range s.queues {
+		if destinationMatches(q.pattern, dest) {
+			targets = append(targets, q)
+		}
+	}
+	s.nextID++
+	msgID := "msg-" + strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+
+	for _, q := range targets {
+		msg := pubsub.Frame{Command: pubsub.StompMessage, Body: f.Body}
+		for _, h := range f.Headers {
+			if h[0] != "receipt" {
+				msg.Set(h[0], h[1])
+			}
+		}
+		msg.Set("message-id", msgID)
+		s.deliver(q, msg)
+	}
+}
+
+// deliver hands msg to the next subscription of q in round-robin order.
+func (s *Server) deliver(q *queue, msg pubsub.Frame) {
+	s.mu.Lock()
+	if len(q.subs) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	sub := q.subs[q.next%len(q.subs)]
+	q.next++
+	s.nextID++
+	ackID := "ack-" + strconv.Itoa(s.nextID)
+	msg.Set("subscription", sub.id)
+	if sub.ack != pubsub.StompAckAuto {
+		msg.Set("ack", ackID)
+		sub.session.pending[ackID] = pendingMessage{queue: q, frame: msg}
+	}
+	s.mu.Unlock()
+
+	sub.session.write(msg)
+}
+
+// drop removes a session's subscriptions and requeues its unacknowledged messages.
+func (s *Server) drop(sess *session) {
+	sess.conn.Close()
+	s.mu.Lock()
+	delete(s.sessions, sess)
+	for _, q := range s.queues {
+		kept := q.subs[:0]
+		for _, sub := range q.subs {
+			if sub.session != sess {
+				kept = append(kept, sub)
+			}
+		}
+		q.subs = kept
+	}
+	pending := sess.pending
+	sess.pending = map[string]pendingMessage{}
+	s.mu.Unlock()
+
+	for _, p := range pending {
+		p.frame.Set("redelivered", "true")
+		s.deliver(p.queue, p.frame)
+	}
+}
+
+func (sess *session) write(f pubsub.Frame) error {
+	sess.wmu.Lock()
+	defer sess.wmu.Unlock()
+	if _, err := f.WriteTo(sess.w); err != nil {
+		return err
+	}
+	return sess.w.Flush()
+}
+
+func (sess *session) heartBeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sess.wmu.Lock()
+		_, err := sess.w.WriteString("\n")
+		if err == nil {
+			err = sess.w.Flush()
+		}
+		sess.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// destinationMatches reports whether dest is addressed by a subscription
+// destination. Exchange destinations use AMQP topic matching on the key.
+func destinationMatches(pattern, dest string) bool {
+	if pattern == dest {
+		return true
+	}
+	pex, pkey, ok1 := splitExchange(pattern)
+	dex, dkey, ok2 := splitExchange(dest)
+	if !ok1 || !ok2 || pex != dex {
+		return false
+	}
+	return pubsub.TopicMatches(pkey, dkey)
+}
+
+func splitExchange(dest string) (exchange, key string, ok bool) {
+	rest, ok := strings.CutPrefix(dest, "/exchange/")
+	if !ok {
+		return "", "", false
+	}
+	exchange, key, _ = strings.Cut(rest, "/")
+	return exchange, key, true
+}
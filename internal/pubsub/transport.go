@@ -0,0 +1,58 @@
+package pubsub
+
+import "log"
+
+// Message is a broker-neutral representation of a published message.
+type Message struct {
+	RoutingKey      string            // Routing key the message was published with
+	ContentType     string            // MIME type of the body
+	ContentEncoding string            // Encoding applied to the body, if any
+	Headers         map[string]string // Application headers
+	Body            []byte            // Raw payload
+}
+
+// Transport is a connection to a message broker that can publish messages to
+// exchanges and consume queues bound to them.
+type Transport interface {
+	// Publish sends msg to the exchange with the given routing key.
+	Publish(exchange, key string, msg Message) error
+	// Subscribe declares a queue, binds it to the exchange with the routing key
+	// and delivers every message on it to handler.
+	Subscribe(
+		exchange, // Exchange name to bind to
+		queueName, // Queue name to create/consume from
+		key string, // Routing key for binding
+		queueType SimpleQueueType, // Queue persistence type
+		handler func(Message) AckType, // Message handler function
+	) error
+	// Close releases the connection to the broker.
+	Close() error
+}
+
+// acknowledger settles a single delivery with the broker.
+type acknowledger interface {
+	ack() error
+	nack(requeue bool) error
+}
+
+// settle runs handler on msg and acknowledges it according to the result.
+func settle(msg Message, acker acknowledger, handler func(Message) AckType) {
+	var err error
+	ackType := handler(msg)
+	switch ackType {
+	case Ack:
+		err = acker.ack()
+		log.Printf("Positive acknowledgement of type %s", ackType.String())
+	case NackRequeue:
+		err = acker.nack(true)
+		log.Printf("Negative acknowledgement of type %s...requeueing", ackType.String())
+	case NackDiscard:
+		err = acker.nack(false)
+		log.Printf("Negative acknowledgement of type %s...discarding", ackType.String())
+	default:
+		log.Printf("Invalid acknowledge type %v", ackType)
+	}
+	if err != nil {
+		log.Printf("Could not acknowledge message %s: %v", msg.Body, err)
+	}
+}
@@ -0,0 +1,157 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// HeaderVersion carries the schema version of a message's payload.
+// Messages without it were published before versioning and are version 1.
+const HeaderVersion = "x-peril-version"
+
+var (
+	// ErrUnknownVersion is returned when a payload is newer than the subscriber understands.
+	ErrUnknownVersion = errors.New("unknown payload version")
+	// ErrNoUpcaster is returned when an older payload has no path to the current version.
+	ErrNoUpcaster = errors.New("no upcaster for payload version")
+)
+
+// Upcaster converts a payload from one schema version to the next.
+// Build one with Upcast so the old and new payload types are checked.
+type Upcaster struct {
+	From   int                               // Version the upcaster reads
+	decode func(Codec, Message) (any, error) // Decodes a version From payload
+	upcast func(any) (any, error)            // Converts a version From value to From+1
+}
+
+// Upcast returns an Upcaster that decodes version from payloads as Old and
+// converts them with fn into the version from+1 type New.
+func Upcast[Old, New any](from int, fn func(Old) (New, error)) Upcaster {
+	return Upcaster{
+		From: from,
+		decode: func(codec Codec, msg Message) (any, error) {
+			var old Old
+			err := codec.Decode(msg, &old)
+			return old, err
+		},
+		upcast: func(val any) (any, error) {
+			old, ok := val.(Old)
+			if !ok {
+				return nil, fmt.Errorf("upcaster from version %d expects %T, got %T", from, old, val)
+			}
+			return fn(old)
+		},
+	}
+}
+
+// VersionedCodec wraps a Codec so that every payload is stamped with its
+// schema version, and payloads published at older versions are upcast to
+// the current one before they reach handlers.
+type VersionedCodec struct {
+	Inner     Codec      // Codec for the payload
+	Version   int        // Current schema version of the payload
+	Upcasters []Upcaster // One upcaster from each older version
+}
+
+// Versioned returns a codec for payloads at version, upcasting older ones.
+func Versioned(inner Codec, version int, upcasters ...Upcaster) VersionedCodec {
+	return VersionedCodec{Inner: inner, Version: version, Upcasters: upcasters}
+}
+
+// ContentType returns the inner codec's content type.
+func (c VersionedCodec) ContentType() string {
+	return c.Inner.ContentType()
+}
+
+// Encode serialises val with the inner codec and sets the version header.
+func (c VersionedCodec) Encode(val any) (Message, error) {
+	msg, err := c.Inner.Encode(val)
+	if err != nil {
+		return Message{}, err
+	}
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderVersion] = strconv.Itoa(c.Version)
+	msg.Headers = headers
+	return msg, nil
+}
+
+// Decode deserialises the body into target, upcasting it first if it was
+// published at an older version.
+func (c VersionedCodec) Decode(msg Message, target any) error {
+	version, err := MessageVersion(msg)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version == c.Version:
+		return c.Inner.Decode(msg, target)
+	case version > c.Version:
+		return fmt.Errorf("%w: %d is newer than %d", ErrUnknownVersion, version, c.Version)
+	}
+
+	first, ok := c.upcaster(version)
+	if !ok {
+		return fmt.Errorf("%w %d", ErrNoUpcaster, version)
+	}
+	val, err := first.decode(c.Inner, msg)
+	if err != nil {
+		return err
+	}
+	for v := version; v < c.Version; v++ {
+		up, ok := c.upcaster(v)
+		if !ok {
+			return fmt.Errorf("%w %d", ErrNoUpcaster, v)
+		}
+		if val, err = up.upcast(val); err != nil {
+			return fmt.Errorf("could not upcast payload from version %d: %w", v, err)
+		}
+	}
+
+	dst := reflect.ValueOf(target).Elem()
+	src := reflect.ValueOf(val)
+	if !src.Type().AssignableTo(dst.Type()) {
+		return fmt.Errorf("upcasters produced %s, want %s", src.Type(), dst.Type())
+	}
+	dst.Set(src)
+	return nil
+}
+
+func (c VersionedCodec) upcaster(from int) (Upcaster, bool) {
+	for _, up := range c.Upcasters {
+		if up.From == from {
+			return up, true
+		}
+	}
+	return Upcaster{}, false
+}
+
+// MessageVersion returns the payload version a message was published at.
+func MessageVersion(msg Message) (int, error) {
+	v, ok := msg.Headers[HeaderVersion]
+	if !ok {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownVersion, v)
+	}
+	return version, nil
+}
+
+// versionOf returns the payload version a codec stamps, or 0 if it is unversioned.
+func versionOf(codec Codec) int {
+	switch c := codec.(type) {
+	case VersionedCodec:
+		return c.Version
+	case CompressedCodec:
+		return versionOf(c.Inner)
+	case SealedCodec:
+		return versionOf(c.Inner)
+	}
+	return 0
+}
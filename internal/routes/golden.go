@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// GoldenDir holds a recorded payload of every route at every schema version,
+// relative to the repository root. Payloads of older versions are kept
+// forever so that their upcasters keep being exercised.
+const GoldenDir = "internal/routes/testdata/golden"
+
+// golden checks one route's recorded payloads against its current codec.
+type golden struct {
+	info   pubsub.RouteInfo
+	encode func() (pubsub.Message, error)        // Encodes the route's sample payload
+	decode func(msg pubsub.Message) (any, error) // Decodes a payload as a subscriber would
+}
+
+func goldenFor[T any](r pubsub.Route[T], sample T) golden {
+	return golden{
+		info: r.Info(),
+		encode: func() (pubsub.Message, error) {
+			return r.Codec.Encode(sample)
+		},
+		decode: func(msg pubsub.Message) (any, error) {
+			var val T
+			if err := r.Codec.Decode(msg, &val); err != nil {
+				return nil, err
+			}
+			if reflect.ValueOf(val).IsZero() {
+				return nil, errors.New("decoded to an empty payload")
+			}
+			return val, nil
+		},
+	}
+}
+
+// goldens returns a sample payload for every route. Changing a sample, or a
+// payload type, requires recording a new golden for the route's version.
+func goldens() []golden {
+	sentAt := time.Date(2025, time.March, 14, 15, 9, 26, 0, time.UTC)
+	alice := gamelogic.Player{
+		Username: "alice",
+		Units: map[int]gamelogic.Unit{
+			1: {ID: 1, Rank: gamelogic.RankInfantry, Location: "europe"},
+			2: {ID: 2, Rank: gamelogic.RankCavalry, Location: "europe", Damage: 1, XP: 2},
+		},
+	}
+	bob := gamelogic.Player{
+		Username: "bob",
+		Units: map[int]gamelogic.Unit{
+			1: {ID: 1, Rank: gamelogic.RankArtillery, Location: "asia"},
+		},
+	}
+	key := func(b byte, n int) []byte { return bytes.Repeat([]byte{b}, n) }
+
+	return []golden{
+		goldenFor(ArmyMoves, gamelogic.ArmyMove{
+			Player:     alice,
+			Units:      []gamelogic.Unit{alice.Units[2]},
+			ToLocation: "asia",
+		}),
+		goldenFor(WarRecognitions, gamelogic.RecognitionOfWar{Attacker: alice, Defender: bob}),
+		goldenFor(Pause, routing.PlayingState{IsPaused: true}),
+		goldenFor(GameLogs, routing.GameLog{
+			CurrentTime: sentAt,
+			Game:        "friday",
+			Message:     "alice won a war against bob",
+			Username:    "alice",
+		}),
+		goldenFor(KeyRegistrations, routing.KeyRegistration{
+			Username:      "alice",
+			PublicKey:     key(0xa1, 32),
+			EncryptionKey: key(0xa2, 32),
+			Proof:         key(0xa3, 64),
+		}),
+		goldenFor(KeyDirectory, routing.KeyDirectory{
+			Keys:           map[string][]byte{"alice": key(0xa1, 32), routing.ServerIdentity: key(0x5e, 32)},
+			EncryptionKeys: map[string][]byte{"alice": key(0xa2, 32)},
+		}),
+		goldenFor(Whispers, routing.Whisper{From: "alice", To: "bob", Message: "meet me in asia", SentAt: sentAt}),
+		goldenFor(LobbyCommands, routing.LobbyCommand{
+			Action:     routing.LobbyCreate,
+			Username:   "alice",
+			Game:       "friday",
+			MaxPlayers: 4,
+		}),
+		goldenFor(LobbyReplies, routing.LobbyReply{
+			Username: "alice",
+			Action:   routing.LobbyList,
+			Rooms: []routing.GameRoom{{
+				ID:         "friday",
+				Host:       "alice",
+				MaxPlayers: 4,
+				Players:    []string{"alice", "bob"},
+				Ready:      []string{"bob"},
+				State:      routing.RoomOpen,
+			}},
+		}),
+		goldenFor(GameStarts, routing.GameStart{Game: "friday", Players: []string{"alice", "bob"}, StartedAt: sentAt}),
+		goldenFor(Heartbeats, routing.Heartbeat{Username: "alice", Game: "friday", SentAt: sentAt}),
+		goldenFor(Presence, routing.PresenceEvent{Username: "alice", Kind: routing.PresenceJoined, Game: "friday", At: sentAt}),
+		goldenFor(Spawns, gamelogic.UnitSpawn{Username: "alice", Unit: gamelogic.Unit{ID: 3, Rank: gamelogic.RankArtillery, Location: "europe"}}),
+		goldenFor(WarResults, gamelogic.WarResult{
+			Attacker: "alice",
+			Defender: "bob",
+			Location: "asia",
+			Winner:   "bob",
+			Losers:   []string{"alice"},
+			Combat:   gamelogic.CombatDice,
+			Seed:     271828,
+			Casualties: map[string][]int{
+				"alice": {1},
+				"bob":   {3},
+			},
+			Survivors: map[string][]gamelogic.Unit{
+				"bob": {{ID: 1, Rank: gamelogic.RankArtillery, Location: "asia", Damage: 2, XP: 1}},
+			},
+		}),
+		goldenFor(WorldQueries, routing.WorldQuery{Username: "alice", Game: "friday"}),
+		goldenFor(WorldStates, gamelogic.WorldState{
+			Game:     "friday",
+			Scenario: *gamelogic.DefaultScenario(),
+			Players:  []gamelogic.Player{alice, bob},
+			Treasuries: []gamelogic.Treasury{
+				{Username: "alice", Balance: 5, Income: 3},
+				{Username: "bob", Balance: 3, Income: 3},
+			},
+			Owners:  map[gamelogic.Location]string{"europe": "alice", "asia": "bob"},
+			LastIDs: map[string]int{"alice": 4, "bob": 1},
+			AsOf:    sentAt,
+		}),
+		goldenFor(Turns, gamelogic.TurnEvent{
+			Game:   "friday",
+			Turn:   2,
+			Phase:  gamelogic.PhaseOrders,
+			EndsAt: sentAt,
+			Revealed: []gamelogic.Orders{
+				{Username: "alice", Turn: 1, Spawns: []gamelogic.Unit{{ID: 2, Rank: gamelogic.RankCavalry, Location: "europe"}}},
+				{Username: "bob", Turn: 1, Moves: []gamelogic.MoveOrder{{Units: []int{1}, ToLocation: "asia"}}},
+			},
+		}),
+		goldenFor(Orders, gamelogic.Orders{
+			Username: "alice",
+			Turn:     2,
+			Spawns:   []gamelogic.Unit{{ID: 3, Rank: gamelogic.RankArtillery, Location: "europe"}},
+			Moves:    []gamelogic.MoveOrder{{Units: []int{1, 2}, ToLocation: "asia"}},
+		}),
+		goldenFor(Treasuries, gamelogic.Treasury{Username: "alice", Balance: 12, Income: 3}),
+		goldenFor(Ownership, gamelogic.OwnershipChange{Game: "friday", Location: "asia", Owner: "alice", Previous: "bob"}),
+		goldenFor(GameOvers, gamelogic.GameOver{
+			Game:   "friday",
+			Winner: "alice",
+			Reason: gamelogic.VictoryElimination,
+			Standings: []gamelogic.Standing{
+				{Username: "alice", Score: 37, Territories: 2, Units: 2, Gold: 11},
+				{Username: "bob", Score: 3, Gold: 3, Eliminated: true},
+			},
+			EndedAt: sentAt,
+		}),
+	}
+}
+
+// WriteGoldens records the current version's payload of every route that has
+// none yet and returns the files it wrote. A recorded payload that no longer
+// matches is never overwritten: the route's version must be bumped instead.
+func WriteGoldens(dir string) ([]string, error) {
+	var written []string
+	for _, g := range goldens() {
+		msg, err := g.encode()
+		if err != nil {
+			return written, fmt.Errorf("could not encode %s sample: %w", g.info.Name, err)
+		}
+		path := goldenPath(dir, g.info, g.info.Version)
+		recorded, err := os.ReadFile(path)
+		switch {
+		case err == nil && bytes.Equal(recorded, msg.Body):
+			continue
+		case err == nil:
+			return written, fmt.Errorf("%s changed without a version bump; raise its version and add an upcaster", g.info.Name)
+		case !errors.Is(err, os.ErrNotExist):
+			return written, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(path, msg.Body, 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// goldenPath names the golden payload of a route at version, e.g. "pause/v1.json".
+func goldenPath(dir string, info pubsub.RouteInfo, version int) string {
+	ext := "bin"
+	switch info.ContentType {
+	case pubsub.JSON.ContentType():
+		ext = "json"
+	case pubsub.Gob.ContentType():
+		ext = "gob"
+	}
+	return filepath.Join(dir, info.Name, fmt.Sprintf("v%d.%s", version, ext))
+}
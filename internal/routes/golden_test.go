@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// goldenDir is GoldenDir relative to this package.
+const goldenDir = "testdata/golden"
+
+// TestGoldens checks that every route's current payload matches its recorded
+// golden and that the golden of every older version still decodes into the
+// current payload type, upcast as upcasts expects.
+func TestGoldens(t *testing.T) {
+	for _, g := range goldens() {
+		t.Run(g.info.Name, func(t *testing.T) {
+			msg, err := g.encode()
+			if err != nil {
+				t.Fatalf("could not encode sample: %v", err)
+			}
+			for v := 1; v <= g.info.Version; v++ {
+				t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+					path := goldenPath(goldenDir, g.info, v)
+					recorded, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatalf("missing golden: %v", err)
+					}
+					if v == g.info.Version && !bytes.Equal(recorded, msg.Body) {
+						t.Errorf("payload changed without a version bump (%s); raise the version and add an upcaster", path)
+					}
+					got, err := g.decode(pubsub.Message{
+						ContentType: g.info.ContentType,
+						Headers:     map[string]string{pubsub.HeaderVersion: strconv.Itoa(v)},
+						Body:        recorded,
+					})
+					if err != nil {
+						t.Fatalf("no longer decodes: %v", err)
+					}
+					if check, ok := upcasts[g.info.Name]; ok && v < g.info.Version {
+						if err := check(v, got); err != nil {
+							t.Errorf("upcasts wrongly: %v", err)
+						}
+					}
+				})
+			}
+
+			entries, _ := os.ReadDir(filepath.Join(goldenDir, g.info.Name))
+			for _, e := range entries {
+				if v, ok := goldenVersion(e.Name()); ok && v > g.info.Version {
+					t.Errorf("golden for version %d is newer than the route", v)
+				}
+			}
+		})
+	}
+}
+
+// upcasts checks what the goldens of a route's older versions upcast to,
+// by route name. Each check is given the golden's version and its payload
+// decoded as the current type.
+var upcasts = map[string]func(version int, got any) error{
+	GameLogs.Name: expect(func(_ int, l routing.GameLog) error {
+		if l.Game != routing.DefaultGame {
+			return fmt.Errorf("game log is in game %q, want %q", l.Game, routing.DefaultGame)
+		}
+		return nil
+	}),
+	WarResults.Name: expect(func(v int, r gamelogic.WarResult) error {
+		if v == 1 && r.Combat != gamelogic.CombatPower {
+			return fmt.Errorf("war was decided by %q, want %q", r.Combat, gamelogic.CombatPower)
+		}
+		if r.Survivors != nil {
+			return fmt.Errorf("war has survivors %v, want none", r.Survivors)
+		}
+		return nil
+	}),
+	ArmyMoves.Name: expect(func(_ int, m gamelogic.ArmyMove) error {
+		return unhurt(append(m.Units, units(m.Player)...))
+	}),
+	Spawns.Name: expect(func(_ int, s gamelogic.UnitSpawn) error {
+		return unhurt([]gamelogic.Unit{s.Unit})
+	}),
+	WorldStates.Name: expect(checkWorldState),
+}
+
+// expect adapts a check of a route's payload type to upcasts.
+func expect[T any](check func(version int, got T) error) func(int, any) error {
+	return func(version int, got any) error {
+		val, ok := got.(T)
+		if !ok {
+			return fmt.Errorf("decoded a %T, want a %T", got, val)
+		}
+		return check(version, val)
+	}
+}
+
+// checkWorldState checks each upcaster a world state of version went
+// through: v1 gained the default scenario, v2 an economy, v3 owners, v4 unit
+// health, v5 the highest IDs used and v6 the default modifiers.
+func checkWorldState(version int, s gamelogic.WorldState) error {
+	defaults := gamelogic.DefaultRuleset()
+	rules := s.Scenario.Rules
+	if version == 1 && s.Scenario.Name != gamelogic.DefaultScenario().Name {
+		return fmt.Errorf("scenario is %q, want the default", s.Scenario.Name)
+	}
+	if version <= 2 {
+		for _, t := range s.Scenario.Map.Territories {
+			if t.Income != 1 {
+				return fmt.Errorf("%s pays %d gold, want 1", t.Name, t.Income)
+			}
+		}
+		for _, u := range rules.Units {
+			if u.Cost != u.Power {
+				return fmt.Errorf("%s costs %d, want its power %d", u.Rank, u.Cost, u.Power)
+			}
+		}
+		if rules.StartingGold != defaults.StartingGold {
+			return fmt.Errorf("players start with %d gold, want %d", rules.StartingGold, defaults.StartingGold)
+		}
+	}
+	if version == 3 && (s.Owners == nil || len(s.Owners) != 0) {
+		return fmt.Errorf("owners are %v, want none", s.Owners)
+	}
+	for _, u := range rules.Units {
+		d, _ := defaults.Unit(u.Rank)
+		if version <= 4 && u.Health != d.Health {
+			return fmt.Errorf("%s has %d health, want %d", u.Rank, u.Health, d.Health)
+		}
+		if version <= 6 && (u.Defence != d.Defence || !reflect.DeepEqual(u.Matchups, d.Matchups)) {
+			return fmt.Errorf("%s has defence %d and matchups %v, want the default ones", u.Rank, u.Defence, u.Matchups)
+		}
+	}
+	if version <= 6 && !reflect.DeepEqual(rules.Terrain, defaults.Terrain) {
+		return fmt.Errorf("terrain is %v, want the default", rules.Terrain)
+	}
+	if version <= 5 {
+		want := map[string]int{}
+		for _, p := range s.Players {
+			for id := range p.Units {
+				want[p.Username] = max(want[p.Username], id)
+			}
+		}
+		if len(want) == 0 || !reflect.DeepEqual(s.LastIDs, want) {
+			return fmt.Errorf("last IDs are %v, want %v", s.LastIDs, want)
+		}
+	}
+	if version <= 4 {
+		var all []gamelogic.Unit
+		for _, p := range s.Players {
+			all = append(all, units(p)...)
+		}
+		return unhurt(all)
+	}
+	return nil
+}
+
+// units returns every unit of p.
+func units(p gamelogic.Player) []gamelogic.Unit {
+	var all []gamelogic.Unit
+	for _, u := range p.Units {
+		all = append(all, u)
+	}
+	return all
+}
+
+// unhurt reports an error unless every unit is undamaged and inexperienced,
+// as units published before they had damage and experience must decode.
+func unhurt(units []gamelogic.Unit) error {
+	for _, u := range units {
+		if u.Damage != 0 || u.XP != 0 {
+			return fmt.Errorf("unit %d has %d damage and %d XP, want none", u.ID, u.Damage, u.XP)
+		}
+	}
+	return nil
+}
+
+// goldenVersion parses the version out of a golden file name.
+func goldenVersion(name string) (int, bool) {
+	base, _, _ := strings.Cut(name, ".")
+	v, err := strconv.Atoi(strings.TrimPrefix(base, "v"))
+	return v, err == nil && strings.HasPrefix(base, "v")
+}
@@ -0,0 +1,413 @@
+// Package routes declares the typed route of every message exchanged in a
+// Peril game, tying each routing key to its payload type and encoding.
+package routes
+
+//go:generate go run ../../cmd/peril-schema -out ../../schema -golden testdata/golden
+
+import (
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var (
+	// ArmyMoves carries every player's unit movements within a game
+	ArmyMoves = pubsub.Route[gamelogic.ArmyMove]{
+		Name:     "army_moves",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.ArmyMovesPrefix + ".{game}.{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 2, pubsub.Upcast(1, unhurtUnits[gamelogic.ArmyMove])),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// WarRecognitions carries wars raised by defenders who spot an attacker's move to the server
+	WarRecognitions = pubsub.Route[gamelogic.RecognitionOfWar]{
+		Name:     "war_recognitions",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.WarRecognitionsPrefix + ".{game}.{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 2, pubsub.Upcast(1, unhurtUnits[gamelogic.RecognitionOfWar])),
+		Queue:    pubsub.SimpleQueueDurable,
+	}
+
+	// Pause carries the server's pause and resume commands for a game
+	Pause = pubsub.Route[routing.PlayingState]{
+		Name:     "pause",
+		Exchange: routing.ExchangePerilDirect,
+		Key:      routing.PauseKey + ".{game}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// GameLogs carries log entries the server writes to disk
+	GameLogs = pubsub.Route[routing.GameLog]{
+		Name:     "game_logs",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.GameLogSlug + ".{game}.{username}",
+		Codec:    pubsub.Versioned(pubsub.Gob, 2, pubsub.Upcast(1, upcastGameLogV1)),
+		Queue:    pubsub.SimpleQueueDurable,
+	}
+
+	// KeyRegistrations carries players' public keys to the server
+	KeyRegistrations = pubsub.Route[routing.KeyRegistration]{
+		Name:     "key_registrations",
+		Exchange: routing.ExchangePerilDirect,
+		Key:      routing.KeysKey,
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueDurable,
+	}
+
+	// KeyDirectory carries the server's list of registered keys to every player
+	KeyDirectory = pubsub.Route[routing.KeyDirectory]{
+		Name:     "key_directory",
+		Exchange: routing.ExchangePerilDirect,
+		Key:      routing.KeyDirectoryKey,
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// Whispers carries private messages sealed for their recipient
+	Whispers = pubsub.Route[routing.Whisper]{
+		Name:     "whispers",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.WhisperPrefix + ".{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// LobbyCommands carries players' requests to create, join, leave and ready up for games
+	LobbyCommands = pubsub.Route[routing.LobbyCommand]{
+		Name:     "lobby_commands",
+		Exchange: routing.ExchangePerilDirect,
+		Key:      routing.LobbyCommandsKey,
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueDurable,
+	}
+
+	// LobbyReplies carries the server's answer to each lobby request
+	LobbyReplies = pubsub.Route[routing.LobbyReply]{
+		Name:     "lobby_replies",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.LobbyReplyPrefix + ".{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// GameStarts carries the server's signal that a game's players are all ready
+	GameStarts = pubsub.Route[routing.GameStart]{
+		Name:     "game_starts",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.GameStartPrefix + ".{game}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// Heartbeats carries each online player's periodic proof of life to the server
+	Heartbeats = pubsub.Route[routing.Heartbeat]{
+		Name:     "heartbeats",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.HeartbeatPrefix + ".{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// Presence carries the server's announcements of players coming online and going offline
+	Presence = pubsub.Route[routing.PresenceEvent]{
+		Name:     "presence",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.PresencePrefix + ".{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// Spawns carries the units players bring into a game to the server
+	Spawns = pubsub.Route[gamelogic.UnitSpawn]{
+		Name:     "spawns",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.SpawnsPrefix + ".{game}.{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 2, pubsub.Upcast(1, unhurtUnits[gamelogic.UnitSpawn])),
+		Queue:    pubsub.SimpleQueueDurable,
+	}
+
+	// WarResults carries the server's verdict on a war to each side. Keys
+	// start with the player so each binds only the wars addressed to them
+	WarResults = pubsub.Route[gamelogic.WarResult]{
+		Name:     "war_results",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.WarPrefix + ".{username}.{game}",
+		Codec: pubsub.Versioned(pubsub.JSON, 3,
+			pubsub.Upcast(1, upcastWarResultV1),
+			pubsub.Upcast(2, unhurtUnits[gamelogic.WarResult]),
+		),
+		Queue: pubsub.SimpleQueueDurable,
+	}
+
+	// WorldQueries carries players' requests for the authoritative world state
+	WorldQueries = pubsub.Route[routing.WorldQuery]{
+		Name:     "world_queries",
+		Exchange: routing.ExchangePerilDirect,
+		Key:      routing.WorldQueryKey,
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// WorldStates carries the server's world state to a player, either in
+	// answer to a query or to correct a player whose view has drifted
+	WorldStates = pubsub.Route[gamelogic.WorldState]{
+		Name:     "world_states",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.WorldStatePrefix + ".{game}.{username}",
+		Codec: pubsub.Versioned(pubsub.JSON, 7,
+			pubsub.Upcast(1, upcastWorldStateV1),
+			pubsub.Upcast(2, upcastWorldStateV2),
+			pubsub.Upcast(3, upcastWorldStateV3),
+			pubsub.Upcast(4, upcastWorldStateV4),
+			pubsub.Upcast(5, upcastWorldStateV5),
+			pubsub.Upcast(6, upcastWorldStateV6),
+		),
+		Queue: pubsub.SimpleQueueTransient,
+	}
+
+	// Turns carries the server's turn clock to the players of a turn-based game
+	Turns = pubsub.Route[gamelogic.TurnEvent]{
+		Name:     "turns",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.TurnPrefix + ".{game}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 2, pubsub.Upcast(1, unhurtUnits[gamelogic.TurnEvent])),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// Orders carries the orders each player gave during a turn to the server
+	// when the turn ends
+	Orders = pubsub.Route[gamelogic.Orders]{
+		Name:     "orders",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.OrdersPrefix + ".{game}.{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 2, pubsub.Upcast(1, unhurtUnits[gamelogic.Orders])),
+		Queue:    pubsub.SimpleQueueDurable,
+	}
+
+	// Treasuries carries the server's account of a player's gold to them
+	// whenever their territories pay income
+	Treasuries = pubsub.Route[gamelogic.Treasury]{
+		Name:     "treasuries",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.TreasuryPrefix + ".{game}.{username}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// Ownership carries territories changing hands to every player of a game
+	Ownership = pubsub.Route[gamelogic.OwnershipChange]{
+		Name:     "ownership",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.OwnershipPrefix + ".{game}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+
+	// GameOvers carries the end of a game and its final standings to every player
+	GameOvers = pubsub.Route[gamelogic.GameOver]{
+		Name:     "game_overs",
+		Exchange: routing.ExchangePerilTopic,
+		Key:      routing.GameOverPrefix + ".{game}",
+		Codec:    pubsub.Versioned(pubsub.JSON, 1),
+		Queue:    pubsub.SimpleQueueTransient,
+	}
+)
+
+// gameLogV1 is a GameLog published before games were scoped.
+type gameLogV1 struct {
+	CurrentTime time.Time
+	Message     string
+	Username    string
+}
+
+// upcastGameLogV1 attributes unscoped logs to the default game.
+func upcastGameLogV1(old gameLogV1) (routing.GameLog, error) {
+	return routing.GameLog{
+		CurrentTime: old.CurrentTime,
+		Game:        routing.DefaultGame,
+		Message:     old.Message,
+		Username:    old.Username,
+	}, nil
+}
+
+// warResultV1 is a WarResult published before wars had casualties.
+type warResultV1 struct {
+	Attacker string
+	Defender string
+	Location gamelogic.Location
+	Winner   string
+	Losers   []string
+}
+
+// upcastWarResultV1 marks wars published before there was a choice of
+// combat as decided by power. Their casualties are unknown, so the losers
+// lose every unit they had where the war was fought, as they used to.
+func upcastWarResultV1(old warResultV1) (gamelogic.WarResult, error) {
+	return gamelogic.WarResult{
+		Attacker: old.Attacker,
+		Defender: old.Defender,
+		Location: old.Location,
+		Winner:   old.Winner,
+		Losers:   old.Losers,
+		Combat:   gamelogic.CombatPower,
+	}, nil
+}
+
+// worldStateV1 is a WorldState published before games had scenarios.
+type worldStateV1 struct {
+	Game    string
+	Players []gamelogic.Player
+	AsOf    time.Time
+	Error   string
+}
+
+// upcastWorldStateV1 places games without a scenario in the default one.
+func upcastWorldStateV1(old worldStateV1) (worldStateV2, error) {
+	return worldStateV2{
+		Game:     old.Game,
+		Scenario: *gamelogic.DefaultScenario(),
+		Players:  old.Players,
+		AsOf:     old.AsOf,
+		Error:    old.Error,
+	}, nil
+}
+
+// worldStateV2 is a WorldState published before games had an economy.
+type worldStateV2 struct {
+	Game     string
+	Scenario gamelogic.Scenario
+	Players  []gamelogic.Player
+	AsOf     time.Time
+	Error    string
+}
+
+// upcastWorldStateV2 prices the units of scenarios published without an
+// economy at their power, has every territory pay one gold, and gives
+// players the default starting gold. The players' treasuries are unknown.
+func upcastWorldStateV2(old worldStateV2) (worldStateV3, error) {
+	s := old.Scenario
+	s.Map.Territories = slices.Clone(s.Map.Territories)
+	for i := range s.Map.Territories {
+		s.Map.Territories[i].Income = 1
+	}
+	s.Rules.Units = slices.Clone(s.Rules.Units)
+	for i := range s.Rules.Units {
+		s.Rules.Units[i].Cost = s.Rules.Units[i].Power
+	}
+	s.Rules.StartingGold = gamelogic.DefaultRuleset().StartingGold
+	return worldStateV3{
+		Game:     old.Game,
+		Scenario: s,
+		Players:  old.Players,
+		AsOf:     old.AsOf,
+		Error:    old.Error,
+	}, nil
+}
+
+// worldStateV3 is a WorldState published before territories were owned.
+type worldStateV3 struct {
+	Game       string
+	Scenario   gamelogic.Scenario
+	Players    []gamelogic.Player
+	Treasuries []gamelogic.Treasury
+	AsOf       time.Time
+	Error      string
+}
+
+// upcastWorldStateV3 leaves every territory unowned; the next world state
+// the server sends says who owns what.
+func upcastWorldStateV3(old worldStateV3) (gamelogic.WorldState, error) {
+	return gamelogic.WorldState{
+		Game:       old.Game,
+		Scenario:   old.Scenario,
+		Players:    old.Players,
+		Treasuries: old.Treasuries,
+		Owners:     map[gamelogic.Location]string{},
+		AsOf:       old.AsOf,
+		Error:      old.Error,
+	}, nil
+}
+
+// upcastWorldStateV4 gives the units of scenarios published before units
+// had health the default ruleset's health for their rank, or one hit point
+// for ranks it does not have. Their units decode unhurt, as unhurtUnits does.
+func upcastWorldStateV4(old gamelogic.WorldState) (gamelogic.WorldState, error) {
+	defaults := gamelogic.DefaultRuleset()
+	old.Scenario.Rules.Units = slices.Clone(old.Scenario.Rules.Units)
+	for i, u := range old.Scenario.Rules.Units {
+		old.Scenario.Rules.Units[i].Health = 1
+		if d, ok := defaults.Unit(u.Rank); ok {
+			old.Scenario.Rules.Units[i].Health = d.Health
+		}
+	}
+	return old, nil
+}
+
+// upcastWorldStateV5 takes the highest ID of each player's living units as
+// the highest they have used, since states published before IDs were
+// tracked do not say which IDs died.
+func upcastWorldStateV5(old gamelogic.WorldState) (gamelogic.WorldState, error) {
+	old.LastIDs = map[string]int{}
+	for _, p := range old.Players {
+		for id := range p.Units {
+			old.LastIDs[p.Username] = max(old.LastIDs[p.Username], id)
+		}
+	}
+	return old, nil
+}
+
+// upcastWorldStateV6 gives scenarios published before rulesets had
+// modifiers the ones every game was played with then: the default ruleset's
+// for its ranks and terrains.
+func upcastWorldStateV6(old gamelogic.WorldState) (gamelogic.WorldState, error) {
+	defaults := gamelogic.DefaultRuleset()
+	old.Scenario.Rules.Units = slices.Clone(old.Scenario.Rules.Units)
+	for i, u := range old.Scenario.Rules.Units {
+		if d, ok := defaults.Unit(u.Rank); ok {
+			old.Scenario.Rules.Units[i].Defence = d.Defence
+			old.Scenario.Rules.Units[i].Matchups = d.Matchups
+		}
+	}
+	old.Scenario.Rules.Terrain = defaults.Terrain
+	return old, nil
+}
+
+// unhurtUnits upcasts payloads published before units had damage and
+// experience. They decode as the current type as they are, every unit unhurt
+// and inexperienced, and war results without survivors leave them as they
+// were.
+func unhurtUnits[T any](old T) (T, error) {
+	return old, nil
+}
+
+// All returns a description of every route in the game.
+func All() []pubsub.RouteInfo {
+	return []pubsub.RouteInfo{
+		ArmyMoves.Info(),
+		WarRecognitions.Info(),
+		Pause.Info(),
+		GameLogs.Info(),
+		KeyRegistrations.Info(),
+		KeyDirectory.Info(),
+		Whispers.Info(),
+		LobbyCommands.Info(),
+		LobbyReplies.Info(),
+		GameStarts.Info(),
+		Heartbeats.Info(),
+		Presence.Info(),
+		Spawns.Info(),
+		WarResults.Info(),
+		WorldQueries.Info(),
+		WorldStates.Info(),
+		Turns.Info(),
+		Orders.Info(),
+		Treasuries.Info(),
+		Ownership.Info(),
+		GameOvers.Info(),
+	}
+}
@@ -0,0 +1,201 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySeparator separates the segments of a routing key.
+const KeySeparator = "."
+
+// MaxUsernameLength is the longest username a player may choose.
+const MaxUsernameLength = 32
+
+// MaxGameIDLength is the longest game ID players may create or join.
+const MaxGameIDLength = 32
+
+var (
+	// ErrInvalidSegment is returned when a value cannot be used as a routing key segment.
+	ErrInvalidSegment = errors.New("invalid routing key segment")
+	// ErrKeyMismatch is returned when a routing key does not have the expected shape.
+	ErrKeyMismatch = errors.New("routing key does not match")
+	// ErrReservedUsername is returned when a player picks a name reserved for the server.
+	ErrReservedUsername = errors.New("username is reserved")
+)
+
+// ValidateSegment checks that s can appear between separators in a routing key.
+// Segments are non-empty printable ASCII and never contain the separator,
+// the topic wildcards '*' and '#', which would let a value change which
+// bindings a key matches, or '/', which splits STOMP destinations.
+func ValidateSegment(s string) error {
+	if s == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidSegment)
+	}
+	for i := 0; i < len(s); i++ {
+		if !isSegmentByte(s[i]) {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidSegment, s, s[i])
+		}
+	}
+	return nil
+}
+
+// ValidateUsername checks that name is usable as a player's username.
+// Usernames are stricter than segments: ASCII letters, digits, '_' and '-'.
+func ValidateUsername(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty username", ErrInvalidSegment)
+	}
+	for i := 0; i < len(name); i++ {
+		if !isUsernameByte(name[i]) {
+			return fmt.Errorf("%w: username %q contains %q", ErrInvalidSegment, name, name[i])
+		}
+	}
+	if len(name) > MaxUsernameLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidSegment, name, MaxUsernameLength)
+	}
+	if name == ServerIdentity {
+		return fmt.Errorf("%w: %s", ErrReservedUsername, name)
+	}
+	return nil
+}
+
+// ValidateGameID checks that id is usable as a game ID. Game IDs follow the
+// same rules as usernames, as both are spliced into routing keys and queue names.
+func ValidateGameID(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: empty game ID", ErrInvalidSegment)
+	}
+	for i := 0; i < len(id); i++ {
+		if !isUsernameByte(id[i]) {
+			return fmt.Errorf("%w: game ID %q contains %q", ErrInvalidSegment, id, id[i])
+		}
+	}
+	if len(id) > MaxGameIDLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidSegment, id, MaxGameIDLength)
+	}
+	return nil
+}
+
+// EscapeSegment encodes arbitrary text as a valid segment by replacing '%'
+// and every byte ValidateSegment rejects with '%' and two hex digits. The
+// empty string escapes to "%".
+func EscapeSegment(s string) string {
+	if s == "" {
+		return "%"
+	}
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' && isSegmentByte(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	return b.String()
+}
+
+// UnescapeSegment reverses EscapeSegment.
+func UnescapeSegment(s string) (string, error) {
+	if s == "%" {
+		return "", nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%':
+			if i+2 >= len(s) {
+				return "", fmt.Errorf("%w: truncated escape in %q", ErrInvalidSegment, s)
+			}
+			hi, ok1 := unhex(s[i+1])
+			lo, ok2 := unhex(s[i+2])
+			if !ok1 || !ok2 {
+				return "", fmt.Errorf("%w: bad escape in %q", ErrInvalidSegment, s)
+			}
+			b.WriteByte(hi<<4 | lo)
+			i += 2
+		case isSegmentByte(c):
+			b.WriteByte(c)
+		default:
+			return "", fmt.Errorf("%w: %q contains %q", ErrInvalidSegment, s, c)
+		}
+	}
+	return b.String(), nil
+}
+
+// BuildKey joins segments into a routing key, rejecting any segment that
+// would change the key's shape.
+func BuildKey(segments ...string) (string, error) {
+	if len(segments) == 0 {
+		return "", fmt.Errorf("%w: no segments", ErrInvalidSegment)
+	}
+	for _, s := range segments {
+		if err := ValidateSegment(s); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(segments, KeySeparator), nil
+}
+
+// ParseKey splits a routing key that starts with prefix and returns the
+// segments that follow it. Every segment must be valid.
+func ParseKey(key, prefix string) ([]string, error) {
+	segments := strings.Split(key, KeySeparator)
+	prefixSegments := strings.Split(prefix, KeySeparator)
+	if len(segments) < len(prefixSegments) {
+		return nil, fmt.Errorf("%w: %q is not under %q", ErrKeyMismatch, key, prefix)
+	}
+	for i, p := range prefixSegments {
+		if segments[i] != p {
+			return nil, fmt.Errorf("%w: %q is not under %q", ErrKeyMismatch, key, prefix)
+		}
+	}
+	rest := segments[len(prefixSegments):]
+	for _, s := range rest {
+		if err := ValidateSegment(s); err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// UsernameFromKey extracts the username from a key of the form "<prefix>.<username>",
+// e.g. "alice" from "war.alice".
+func UsernameFromKey(key, prefix string) (string, error) {
+	rest, err := ParseKey(key, prefix)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) != 1 {
+		return "", fmt.Errorf("%w: %q is not %s.<username>", ErrKeyMismatch, key, prefix)
+	}
+	return rest[0], nil
+}
+
+func isSegmentByte(c byte) bool {
+	return c > ' ' && c < 0x7f && c != '.' && c != '*' && c != '#' && c != '/'
+}
+
+func isUsernameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' ||
+		c == '_' || c == '-'
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
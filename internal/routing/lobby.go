@@ -0,0 +1,81 @@
+package routing
+
+import "time"
+
+// LobbyAction is a request a player makes of the server's lobby.
+type LobbyAction string
+
+const (
+	// LobbyCreate opens a new game room hosted by the player
+	LobbyCreate LobbyAction = "create"
+	// LobbyJoin adds the player to an open game room
+	LobbyJoin LobbyAction = "join"
+	// LobbyLeave removes the player from their game room
+	LobbyLeave LobbyAction = "leave"
+	// LobbyReady marks the player ready, or not ready, to start
+	LobbyReady LobbyAction = "ready"
+	// LobbyList asks for every game room
+	LobbyList LobbyAction = "list"
+)
+
+// RoomState is the lifecycle stage of a game room.
+type RoomState string
+
+const (
+	// RoomOpen rooms accept players and wait for everyone to be ready
+	RoomOpen RoomState = "open"
+	// RoomStarted rooms are being played and accept no new players
+	RoomStarted RoomState = "started"
+	// RoomFinished rooms have been played to the end and wait for their players to leave
+	RoomFinished RoomState = "finished"
+)
+
+// LobbyCommand is a player's request to the lobby.
+type LobbyCommand struct {
+	Action     LobbyAction // What the player asks for
+	Username   string      // The player making the request
+	Game       string      // Room to create or join
+	MaxPlayers int         // Room capacity when creating, 0 for the default
+	Ready      bool        // Whether the player is ready when readying
+}
+
+// Author returns the player who made the request.
+func (c LobbyCommand) Author() string {
+	return c.Username
+}
+
+// GameRoom is a game as seen from the lobby.
+type GameRoom struct {
+	ID         string    // Game ID
+	Host       string    // Player who created the room, or its longest-standing member
+	MaxPlayers int       // Most players the room accepts
+	Players    []string  // Members in order of joining
+	Ready      []string  // Members who are ready to start
+	State      RoomState // Lifecycle stage of the room
+}
+
+// LobbyReply is the server's answer to a LobbyCommand.
+type LobbyReply struct {
+	Username string      // The player who made the request
+	Action   LobbyAction // The request being answered
+	Game     string      // Room the request concerned
+	Error    string      // Why the request was refused, empty if it succeeded
+	Rooms    []GameRoom  // Every room, in answer to LobbyList
+}
+
+// Author returns the identity allowed to answer lobby requests.
+func (LobbyReply) Author() string {
+	return ServerIdentity
+}
+
+// GameStart signals that every member of a room is ready and play has begun.
+type GameStart struct {
+	Game      string    // Game that started
+	Players   []string  // Members of the game
+	StartedAt time.Time // When the game started
+}
+
+// Author returns the identity allowed to start games.
+func (GameStart) Author() string {
+	return ServerIdentity
+}
@@ -11,6 +11,50 @@ type PlayingState struct {
 // GameLog represents a game event log entry with timestamp, message, and user.
 type GameLog struct {
 	CurrentTime time.Time // When the log entry was created
+	Game        string    // The game the entry belongs to
 	Message     string    // The log message content
 	Username    string    // The player who generated the log
 }
+
+// Author returns the identity allowed to publish pause/resume messages.
+func (PlayingState) Author() string {
+	return ServerIdentity
+}
+
+// Author returns the player who generated the log entry.
+func (gl GameLog) Author() string {
+	return gl.Username
+}
+
+// KeyRegistration announces a player's Ed25519 public key to the server.
+type KeyRegistration struct {
+	Username      string // Player the key belongs to
+	PublicKey     []byte // Ed25519 public key
+	EncryptionKey []byte // X25519 public key for messages sealed to the player
+	Proof         []byte // Signature over the username and encryption key made with the private key
+}
+
+// KeyDirectory is the server's list of registered public keys, by identity.
+type KeyDirectory struct {
+	Keys           map[string][]byte // Ed25519 public keys keyed by player username or ServerIdentity
+	EncryptionKeys map[string][]byte // X25519 public keys keyed by player username
+}
+
+// Author returns the identity allowed to publish the key directory.
+func (KeyDirectory) Author() string {
+	return ServerIdentity
+}
+
+// Whisper is a private message between two players. It is always published
+// sealed for the recipient, so only they can read it.
+type Whisper struct {
+	From    string    // Player sending the message
+	To      string    // Player the message is sealed for
+	Message string    // The message content
+	SentAt  time.Time // When the message was sent
+}
+
+// Author returns the player who sent the whisper.
+func (w Whisper) Author() string {
+	return w.From
+}
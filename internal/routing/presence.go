@@ -0,0 +1,46 @@
+package routing
+
+import "time"
+
+// Heartbeat tells the server a player is still online.
+type Heartbeat struct {
+	Username string    // The player who is online
+	Game     string    // Game the player is in, empty in the lobby
+	SentAt   time.Time // When the heartbeat was sent
+	Leaving  bool      // Whether the player is quitting
+}
+
+// Author returns the player the heartbeat is for.
+func (hb Heartbeat) Author() string {
+	return hb.Username
+}
+
+// PresenceKind is a change in whether a player is online.
+type PresenceKind string
+
+const (
+	// PresenceJoined is announced on a player's first heartbeat
+	PresenceJoined PresenceKind = "joined"
+	// PresenceLeft is announced when a player quits
+	PresenceLeft PresenceKind = "left"
+	// PresenceTimedOut is announced when a player's heartbeats stop
+	PresenceTimedOut PresenceKind = "timed_out"
+)
+
+// PresenceEvent announces that a player came online or went offline.
+type PresenceEvent struct {
+	Username string       // The player whose presence changed
+	Kind     PresenceKind // How their presence changed
+	Game     string       // Game the player was last seen in
+	At       time.Time    // When the server noticed the change
+}
+
+// Author returns the identity allowed to announce presence changes.
+func (PresenceEvent) Author() string {
+	return ServerIdentity
+}
+
+// Online reports whether the event leaves the player online.
+func (e PresenceEvent) Online() bool {
+	return e.Kind == PresenceJoined
+}
@@ -6,16 +6,78 @@ const (
 	// ArmyMovesPrefix is the routing key prefix for army movement messages
 	ArmyMovesPrefix = "army_moves"
 
-	// WarRecognitionsPrefix is the routing key prefix for war declaration messages
-	WarRecognitionsPrefix = "war"
+	// WarRecognitionsPrefix is the routing key prefix for wars defenders raise with the server
+	WarRecognitionsPrefix = "war_declarations"
+
+	// WarPrefix is the routing key prefix for the war results addressed to each player
+	WarPrefix = "war"
+
+	// LegacyWarQueue is the queue every client shared for war declarations
+	// before wars were resolved by the server and routed to each player
+	LegacyWarQueue = "war"
 
 	// PauseKey is the routing key for pause/resume game state messages
 	PauseKey = "pause"
 
 	// GameLogSlug is the routing key for game log messages
 	GameLogSlug = "game_logs"
+
+	// KeysKey is the routing key players register their public keys on
+	KeysKey = "keys"
+
+	// KeyDirectoryKey is the routing key the server broadcasts the key directory on
+	KeyDirectoryKey = "key_directory"
+
+	// WhisperPrefix is the routing key prefix for sealed private messages
+	WhisperPrefix = "whisper"
+
+	// LobbyCommandsKey is the routing key players send lobby requests on
+	LobbyCommandsKey = "lobby_commands"
+
+	// LobbyReplyPrefix is the routing key prefix for the server's lobby replies
+	LobbyReplyPrefix = "lobby_reply"
+
+	// GameStartPrefix is the routing key prefix for game start signals
+	GameStartPrefix = "game_start"
+
+	// HeartbeatPrefix is the routing key prefix for player heartbeats
+	HeartbeatPrefix = "heartbeat"
+
+	// PresencePrefix is the routing key prefix for presence change announcements
+	PresencePrefix = "presence"
+
+	// SpawnsPrefix is the routing key prefix for unit spawn announcements
+	SpawnsPrefix = "spawns"
+
+	// WorldQueryKey is the routing key players ask the server for the world state on
+	WorldQueryKey = "world_query"
+
+	// WorldStatePrefix is the routing key prefix for the server's world state snapshots
+	WorldStatePrefix = "world_state"
+
+	// TurnPrefix is the routing key prefix for the turn clock of turn-based games
+	TurnPrefix = "turn"
+
+	// OrdersPrefix is the routing key prefix for the orders players give in a turn
+	OrdersPrefix = "orders"
+
+	// TreasuryPrefix is the routing key prefix for the server's account of each player's gold
+	TreasuryPrefix = "treasury"
+
+	// OwnershipPrefix is the routing key prefix for territories changing hands
+	OwnershipPrefix = "ownership"
+
+	// GameOverPrefix is the routing key prefix for the end of a game and its standings
+	GameOverPrefix = "game_over"
 )
 
+// ServerIdentity is the identity the game server signs its messages as.
+const ServerIdentity = "peril_server"
+
+// DefaultGame is the game that messages published before games were
+// scoped are attributed to.
+const DefaultGame = "default"
+
 // Exchange names used in the Peril game messaging system.
 
 const (
@@ -0,0 +1,12 @@
+package routing
+
+// WorldQuery asks the server for the authoritative state of a game.
+type WorldQuery struct {
+	Username string // Player asking, who the answer is addressed to
+	Game     string // Game to describe
+}
+
+// Author returns the player asking.
+func (q WorldQuery) Author() string {
+	return q.Username
+}
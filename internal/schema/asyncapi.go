@@ -0,0 +1,192 @@
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// AsyncAPIVersion is the AsyncAPI specification version documents follow.
+const AsyncAPIVersion = "3.0.0"
+
+// Document is an AsyncAPI-style description of every channel in the game.
+type Document struct {
+	AsyncAPI   string              `json:"asyncapi"`
+	Info       Info                `json:"info"`
+	Channels   map[string]Channel  `json:"channels"`
+	Components Components          `json:"components"`
+	Exchanges  map[string]Exchange `json:"x-peril-exchanges"`
+}
+
+// Info identifies the API a Document describes.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Channel is one routing key template on one exchange.
+type Channel struct {
+	Address    string                `json:"address"`
+	Parameters map[string]Parameter  `json:"parameters,omitempty"`
+	Messages   map[string]Reference  `json:"messages"`
+	Bindings   map[string]AMQPBinder `json:"bindings"`
+}
+
+// Parameter is a placeholder in a channel address.
+type Parameter struct {
+	Description string `json:"description,omitempty"`
+}
+
+// Reference points at a component.
+type Reference struct {
+	Ref string `json:"$ref"`
+}
+
+// AMQPBinder describes how a channel maps onto AMQP 0-9-1.
+type AMQPBinder struct {
+	Is       string       `json:"is"`
+	Exchange AMQPExchange `json:"exchange"`
+	Queue    *AMQPQueue   `json:"queue,omitempty"`
+	Version  string       `json:"bindingVersion"`
+}
+
+// AMQPExchange names the exchange a channel is published on.
+type AMQPExchange struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// AMQPQueue describes the queues subscribers declare for a channel.
+type AMQPQueue struct {
+	Durable    bool `json:"durable"`
+	Exclusive  bool `json:"exclusive"`
+	AutoDelete bool `json:"autoDelete"`
+}
+
+// Components holds the messages and payload schemas channels refer to.
+type Components struct {
+	Messages map[string]MessageDef `json:"messages"`
+	Schemas  map[string]*Schema    `json:"schemas"`
+}
+
+// MessageDef describes the content of messages on a channel.
+type MessageDef struct {
+	Name        string  `json:"name"`
+	ContentType string  `json:"contentType"`
+	Headers     *Schema `json:"headers,omitempty"`
+	Payload     *Schema `json:"payload"`
+}
+
+// Exchange describes a broker exchange.
+type Exchange struct {
+	Type string `json:"type"`
+}
+
+// Options configures document generation.
+type Options struct {
+	Title       string                 // Document title
+	Version     string                 // Version of the described API
+	Description string                 // Free-form summary
+	Exchanges   map[string]string      // Exchange kind by exchange name
+	Enums       map[reflect.Type][]any // Allowed values of named types
+	Parameters  map[string]string      // Descriptions of key placeholders
+}
+
+// NewDocument describes routes as an AsyncAPI-style document.
+func NewDocument(routes []pubsub.RouteInfo, opts Options) Document {
+	r := NewReflector("#/components/schemas/", opts.Enums)
+	doc := Document{
+		AsyncAPI: AsyncAPIVersion,
+		Info:     Info{Title: opts.Title, Version: opts.Version, Description: opts.Description},
+		Channels: map[string]Channel{},
+		Components: Components{
+			Messages: map[string]MessageDef{},
+		},
+		Exchanges: map[string]Exchange{},
+	}
+	for name, kind := range opts.Exchanges {
+		doc.Exchanges[name] = Exchange{Type: kind}
+	}
+
+	for _, route := range routes {
+		doc.Components.Messages[route.Name] = MessageDef{
+			Name:        route.Payload.Name(),
+			ContentType: route.ContentType,
+			Headers:     versionHeaders(route.Version),
+			Payload:     r.Reflect(route.Payload),
+		}
+		durable := route.Queue == pubsub.SimpleQueueDurable
+		doc.Channels[route.Name] = Channel{
+			Address:    route.Key,
+			Parameters: keyParameters(route.Key, opts.Parameters),
+			Messages: map[string]Reference{
+				route.Name: {Ref: "#/components/messages/" + route.Name},
+			},
+			Bindings: map[string]AMQPBinder{
+				"amqp": {
+					Is:       "routingKey",
+					Exchange: AMQPExchange{Name: route.Exchange, Type: opts.Exchanges[route.Exchange]},
+					Queue:    &AMQPQueue{Durable: durable, Exclusive: !durable, AutoDelete: !durable},
+					Version:  "0.3.0",
+				},
+			},
+		}
+	}
+	doc.Components.Schemas = r.Defs()
+	return doc
+}
+
+// NewJSONSchema returns a single JSON Schema whose definitions describe the
+// payload of every route, keyed by payload type name.
+func NewJSONSchema(routes []pubsub.RouteInfo, id string, enums map[reflect.Type][]any) *Schema {
+	r := NewReflector("#/$defs/", enums)
+	var payloads []*Schema
+	seen := map[reflect.Type]bool{}
+	for _, route := range routes {
+		if seen[route.Payload] {
+			continue
+		}
+		seen[route.Payload] = true
+		payloads = append(payloads, r.Reflect(route.Payload))
+	}
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].Ref < payloads[j].Ref })
+	return &Schema{
+		Schema: Draft,
+		ID:     id,
+		Title:  "Peril wire messages",
+		AnyOf:  payloads,
+		Defs:   r.Defs(),
+	}
+}
+
+// versionHeaders describes the header carrying a payload's schema version.
+func versionHeaders(version int) *Schema {
+	if version == 0 {
+		return nil
+	}
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			pubsub.HeaderVersion: {Type: "string", Enum: []any{strconv.Itoa(version)}},
+		},
+	}
+}
+
+// keyParameters lists the {placeholders} of a routing key template.
+func keyParameters(key string, descriptions map[string]string) map[string]Parameter {
+	params := map[string]Parameter{}
+	for _, segment := range strings.Split(key, ".") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			params[name] = Parameter{Description: descriptions[name]}
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
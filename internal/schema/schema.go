@@ -0,0 +1,154 @@
+// Package schema describes Peril's wire messages for tools not written in Go.
+// It reflects over the payload type of every route to produce JSON Schema and
+// an AsyncAPI-style document of exchanges, routing keys and content types.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect generated schemas declare.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document or subschema.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	PropertyNames        *Schema            `json:"propertyNames,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+var (
+	timeType  = reflect.TypeFor[time.Time]()
+	bytesType = reflect.TypeFor[[]byte]()
+)
+
+// Reflector builds schemas for Go types. Named struct types are emitted once
+// as definitions and referenced from every place they are used.
+type Reflector struct {
+	// DefsPrefix is prepended to definition names in references,
+	// e.g. "#/$defs/" or "#/components/schemas/".
+	DefsPrefix string
+	// Enums lists the allowed values of named types, which reflection
+	// cannot discover from constant declarations.
+	Enums map[reflect.Type][]any
+
+	defs map[string]*Schema
+}
+
+// NewReflector returns a Reflector whose references point at defsPrefix.
+func NewReflector(defsPrefix string, enums map[reflect.Type][]any) *Reflector {
+	return &Reflector{DefsPrefix: defsPrefix, Enums: enums, defs: map[string]*Schema{}}
+}
+
+// Defs returns the definitions collected so far, keyed by type name.
+func (r *Reflector) Defs() map[string]*Schema {
+	return r.defs
+}
+
+// Reflect returns the schema of t as encoding/json would serialise it.
+func (r *Reflector) Reflect(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case bytesType:
+		return &Schema{Type: "string", ContentEncoding: "base64"}
+	}
+	s := r.reflectKind(t)
+	if values, ok := r.Enums[t]; ok {
+		s.Enum = values
+	}
+	return s
+}
+
+// reflectKind describes t by its kind, ignoring types with special encodings.
+func (r *Reflector) reflectKind(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Pointer:
+		return &Schema{AnyOf: []*Schema{r.Reflect(t.Elem()), {Type: "null"}}}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.Reflect(t.Elem())}
+	case reflect.Map:
+		s := &Schema{Type: "object", AdditionalProperties: r.Reflect(t.Elem())}
+		switch t.Key().Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s.PropertyNames = &Schema{Pattern: "^-?[0-9]+$"}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s.PropertyNames = &Schema{Pattern: "^[0-9]+$"}
+		}
+		return s
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.reflectStruct(t)
+		}
+		name := t.Name()
+		if _, ok := r.defs[name]; !ok {
+			r.defs[name] = nil // reserve the name so recursive types terminate
+			r.defs[name] = r.reflectStruct(t)
+		}
+		return &Schema{Ref: r.DefsPrefix + name}
+	case reflect.Interface:
+		return &Schema{}
+	default:
+		panic(fmt.Sprintf("schema: unsupported type %s", t))
+	}
+}
+
+// reflectStruct describes the exported fields of a struct.
+func (r *Reflector) reflectStruct(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Title: t.Name(), Properties: map[string]*Schema{}}
+	r.addFields(s, t)
+	sort.Strings(s.Required)
+	return s
+}
+
+// addFields adds t's fields to s, flattening untagged embedded structs the
+// way encoding/json does.
+func (r *Reflector) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			r.addFields(s, f.Type)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = r.Reflect(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
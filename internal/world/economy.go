@@ -0,0 +1,58 @@
+package world
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// PayIncome credits every player of a game with the income of the
+// territories they hold and returns their treasuries, sorted by username.
+func (w *World) PayIncome(game string) ([]gamelogic.Treasury, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	if g.over != nil {
+		return nil, fmt.Errorf("%w: %s", ErrGameOver, game)
+	}
+	for username := range g.players {
+		g.gold[username] += g.income(username)
+	}
+	return g.treasuries(), nil
+}
+
+// Treasuries returns every player of a game's gold and income, sorted by username.
+func (w *World) Treasuries(game string) ([]gamelogic.Treasury, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	return g.treasuries(), nil
+}
+
+// income returns the gold the territories a player owns pay them.
+func (g *game) income(username string) int {
+	income := 0
+	for _, t := range g.scenario.Map.Territories {
+		if g.owners[t.Name] == username {
+			income += t.Income
+		}
+	}
+	return income
+}
+
+// treasuries returns every player's gold and income, sorted by username.
+func (g *game) treasuries() []gamelogic.Treasury {
+	var ts []gamelogic.Treasury
+	for username := range g.players {
+		ts = append(ts, gamelogic.Treasury{Username: username, Balance: g.gold[username], Income: g.income(username)})
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Username < ts[j].Username })
+	return ts
+}
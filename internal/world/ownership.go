@@ -0,0 +1,75 @@
+package world
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// OwnershipChanges returns the territories of a game that changed hands
+// since it was last called, in the order they did.
+func (w *World) OwnershipChanges(game string) ([]gamelogic.OwnershipChange, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	changes := g.changes
+	g.changes = nil
+	return changes, nil
+}
+
+// Owned returns the territories a player of a game owns, sorted.
+func (w *World) Owned(game, username string) ([]gamelogic.Location, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.player(game, username); err != nil {
+		return nil, err
+	}
+	return w.games[game].owned(username), nil
+}
+
+// claim gives every territory where only one player has units to that
+// player, recording the territories that change hands.
+func (g *game) claim(game string) {
+	for _, loc := range g.scenario.Map.Locations() {
+		present := g.playersIn(loc)
+		if len(present) != 1 || g.owners[loc] == present[0] {
+			continue
+		}
+		g.changes = append(g.changes, gamelogic.OwnershipChange{
+			Game:     game,
+			Location: loc,
+			Owner:    present[0],
+			Previous: g.owners[loc],
+		})
+		g.owners[loc] = present[0]
+	}
+}
+
+// controls reports whether the player owns loc and no other player has units there.
+func (g *game) controls(username string, loc gamelogic.Location) bool {
+	if g.owners[loc] != username {
+		return false
+	}
+	for _, p := range g.playersIn(loc) {
+		if p != username {
+			return false
+		}
+	}
+	return true
+}
+
+// owned returns the territories a player owns, sorted.
+func (g *game) owned(username string) []gamelogic.Location {
+	var locs []gamelogic.Location
+	for loc, owner := range g.owners {
+		if owner == username {
+			locs = append(locs, loc)
+		}
+	}
+	slices.Sort(locs)
+	return locs
+}
@@ -0,0 +1,122 @@
+package world
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// TurnReport is what resolving a turn did to a game.
+type TurnReport struct {
+	Revealed []gamelogic.Orders    // Orders that were carried out, by username
+	Rejected []string              // Orders that were not, and why
+	Wars     []gamelogic.WarResult // Wars fought where players' units met
+}
+
+// ResolveTurn carries out every player's orders for a turn at once. New units
+// spawn first, with IDs the server assigns. Moves are then checked against where units stood when the
+// turn started, so no player's orders depend on another's, and each unit
+// moves at most once. Finally, wherever units of several players have met,
+// they fight until one side is left; players who moved in attack those who
+// were already there. Illegal orders are left out and reported.
+func (w *World) ResolveTurn(game string, orders []gamelogic.Orders) (TurnReport, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return TurnReport{}, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	if g.over != nil {
+		return TurnReport{}, fmt.Errorf("%w: %s", ErrGameOver, game)
+	}
+	var report TurnReport
+	reject := func(username, format string, args ...any) {
+		report.Rejected = append(report.Rejected, username+": "+fmt.Sprintf(format, args...))
+	}
+
+	// Take one set of orders from each player
+	var given []gamelogic.Orders
+	seen := map[string]bool{}
+	for _, o := range orders {
+		if _, ok := g.players[o.Username]; !ok {
+			reject(o.Username, "%v", ErrNotPlayer)
+			continue
+		}
+		if seen[o.Username] {
+			reject(o.Username, "orders were given twice")
+			continue
+		}
+		seen[o.Username] = true
+		given = append(given, o)
+	}
+	sort.Slice(given, func(i, j int) bool { return given[i].Username < given[j].Username })
+
+	// Where every unit stood when the turn started
+	start := map[string]map[int]gamelogic.Unit{}
+	for username, p := range g.players {
+		start[username] = maps.Clone(p.Units)
+	}
+
+	report.Revealed = make([]gamelogic.Orders, len(given))
+	for i, o := range given {
+		carried := &report.Revealed[i]
+		*carried = gamelogic.Orders{Username: o.Username, Turn: o.Turn}
+		for _, unit := range o.Spawns {
+			// The server numbers the units it spawns, uniquely across players
+			unit.ID = g.assignID()
+			if err := g.spawn(o.Username, unit); err != nil {
+				reject(o.Username, "spawn of %s in %s: %v", unit.Rank, unit.Location, err)
+				continue
+			}
+			// A founding spawn claims its territory for the spawns after it
+			g.claim(game)
+			carried.Spawns = append(carried.Spawns, unit)
+		}
+	}
+
+	// Who moved into each location, to tell attackers from defenders
+	movedInto := map[gamelogic.Location]map[string]bool{}
+	for i, o := range given {
+		carried := &report.Revealed[i]
+		moved := map[int]bool{}
+		for _, mv := range o.Moves {
+			accepted := gamelogic.MoveOrder{ToLocation: mv.ToLocation}
+			for _, id := range mv.Units {
+				unit, ok := start[o.Username][id]
+				if !ok {
+					reject(o.Username, "move of unit %d: no such unit at the start of the turn", id)
+					continue
+				}
+				if moved[id] {
+					reject(o.Username, "move of unit %d: already moved this turn", id)
+					continue
+				}
+				if err := g.scenario.CheckMove(unit, mv.ToLocation); err != nil {
+					reject(o.Username, "move of unit %d: %v", id, fmt.Errorf("%w: %v", ErrIllegalMove, err))
+					continue
+				}
+				moved[id] = true
+				unit.Location = mv.ToLocation
+				g.players[o.Username].Units[id] = unit
+				accepted.Units = append(accepted.Units, id)
+			}
+			if len(accepted.Units) == 0 {
+				continue
+			}
+			carried.Moves = append(carried.Moves, accepted)
+			if movedInto[mv.ToLocation] == nil {
+				movedInto[mv.ToLocation] = map[string]bool{}
+			}
+			movedInto[mv.ToLocation][o.Username] = true
+		}
+	}
+
+	// Fight wherever players have met
+	for _, loc := range g.scenario.Map.Locations() {
+		report.Wars = append(report.Wars, g.fight(loc, movedInto[loc])...)
+	}
+	g.claim(game)
+	return report, nil
+}
@@ -0,0 +1,123 @@
+package world
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// Victory is how games are won besides by eliminating every opponent, which
+// always wins.
+type Victory struct {
+	Territories int           // Territories a player must own to win; zero if owning them never wins
+	HoldFor     int           // Ticks or turns in a row a player must own them for
+	TimeLimit   time.Duration // How long games last before the highest score wins; zero for no limit
+}
+
+// Judge decides whether a game has been won, and if so ends it. It must be
+// called once per tick or turn, which is what v.HoldFor counts. A game is
+// won by the last player not eliminated, then by a player who owned enough
+// territories for long enough, then, once time is up, by the highest score;
+// a tie for the win is a draw. A game that is over refuses spawns, moves
+// and wars, and is left out of Games.
+func (w *World) Judge(game string, v Victory, now time.Time) (gamelogic.GameOver, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return gamelogic.GameOver{}, false, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	if g.over != nil {
+		return *g.over, true, nil
+	}
+
+	standings := g.standings()
+	over := gamelogic.GameOver{Game: game, Standings: standings, EndedAt: now}
+	var alive []string
+	for _, s := range standings {
+		if !s.Eliminated {
+			alive = append(alive, s.Username)
+		}
+	}
+
+	var holders []string
+	for username := range g.players {
+		if v.Territories > 0 && len(g.owned(username)) >= v.Territories {
+			g.held[username]++
+		} else {
+			g.held[username] = 0
+		}
+		if v.Territories > 0 && g.held[username] >= v.HoldFor {
+			holders = append(holders, username)
+		}
+	}
+
+	switch {
+	case len(g.players) > 1 && len(alive) <= 1:
+		over.Reason = gamelogic.VictoryElimination
+		if len(alive) == 1 {
+			over.Winner = alive[0]
+		}
+	case len(holders) > 0:
+		over.Reason = gamelogic.VictoryTerritories
+		over.Winner = best(standings, holders)
+	case v.TimeLimit > 0 && now.Sub(g.started) >= v.TimeLimit:
+		over.Reason = gamelogic.VictoryTimeLimit
+		over.Winner = best(standings, alive)
+	default:
+		return gamelogic.GameOver{}, false, nil
+	}
+	g.over = &over
+	return over, true, nil
+}
+
+// standings ranks the players of a game: players still in the game first,
+// then by score, then by username.
+func (g *game) standings() []gamelogic.Standing {
+	var standings []gamelogic.Standing
+	for username, p := range g.players {
+		units := make([]gamelogic.Unit, 0, len(p.Units))
+		for _, u := range p.Units {
+			units = append(units, u)
+		}
+		territories := len(g.owned(username))
+		s := gamelogic.Standing{
+			Username:    username,
+			Territories: territories,
+			Units:       len(units),
+			Gold:        g.gold[username],
+			Eliminated:  g.fielded[username] && len(units) == 0 && territories == 0,
+		}
+		s.Score = 10*territories + g.scenario.Rules.Power(units) + s.Gold
+		standings = append(standings, s)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Eliminated != b.Eliminated {
+			return !a.Eliminated
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Username < b.Username
+	})
+	return standings
+}
+
+// best returns whichever of the candidates ranks highest in standings, or
+// nobody if the top two of them tie on score.
+func best(standings []gamelogic.Standing, candidates []string) string {
+	var top []gamelogic.Standing
+	for _, s := range standings {
+		if slices.Contains(candidates, s.Username) {
+			top = append(top, s)
+		}
+	}
+	if len(top) == 0 || (len(top) > 1 && top[0].Score == top[1].Score) {
+		return ""
+	}
+	return top[0].Username
+}
@@ -0,0 +1,395 @@
+// Package world keeps the server's authoritative state of every game: which
+// players take part and where each of their units is. It is built from the
+// moves and spawns players publish and the wars the server resolves, and is
+// what the players' own views are checked against.
+package world
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+var (
+	// ErrNoGame is returned for games that have not started.
+	ErrNoGame = errors.New("no such game")
+	// ErrGameExists is returned when starting a game whose ID is in use.
+	ErrGameExists = errors.New("game already started")
+	// ErrNotPlayer is returned for players who are not part of the game.
+	ErrNotPlayer = errors.New("not a player of the game")
+	// ErrUnitExists is returned when a spawn reuses one of the player's unit
+	// IDs, whether the unit is alive or dead.
+	ErrUnitExists = errors.New("unit ID already used")
+	// ErrIllegalMove is returned for moves the game's map does not allow.
+	ErrIllegalMove = errors.New("illegal move")
+	// ErrNotOnMap is returned for spawns outside the game's map.
+	ErrNotOnMap = errors.New("location is not on the map")
+	// ErrUnknownRank is returned for spawns of units the game's rules do not have.
+	ErrUnknownRank = errors.New("unit is not in the ruleset")
+	// ErrNotHeld is returned for spawns in territories the player does not control.
+	ErrNotHeld = errors.New("territory is not controlled by the player")
+	// ErrCannotAfford is returned for spawns the player does not have the gold for.
+	ErrCannotAfford = errors.New("not enough gold")
+	// ErrGameOver is returned for spawns, moves and wars in games that have ended.
+	ErrGameOver = errors.New("the game is over")
+	// ErrTurnBased is returned for moves, spawns and wars outside of a turn in
+	// a turn-based game.
+	ErrTurnBased = errors.New("the game is played in turns")
+)
+
+// World holds the state of every started game. It is safe for concurrent use.
+type World struct {
+	mu    sync.Mutex
+	games map[string]*game
+}
+
+// game is the state of one game.
+type game struct {
+	scenario  *gamelogic.Scenario           // Map and rules the game is played with
+	combat    gamelogic.Combat              // How the game's wars are decided
+	players   map[string]gamelogic.Player   // Players by username
+	turnBased bool                          // Whether orders are only carried out by ResolveTurn
+	gold      map[string]int                // Each player's gold, by username
+	owners    map[gamelogic.Location]string // Owner of every territory somebody owns
+	changes   []gamelogic.OwnershipChange   // Ownership changes not yet taken by OwnershipChanges
+	started   time.Time                     // When the game started
+	fielded   map[string]bool               // Players who have had units, and so can be eliminated
+	held      map[string]int                // Ticks or turns in a row each player has owned enough territories to win
+	over      *gamelogic.GameOver           // How the game ended, nil while it is played
+	lastIDs   map[string]int                // Highest unit ID each player has used, by username
+	assigned  int                           // Highest unit ID used by anyone, above which the server assigns IDs
+	paused    bool                          // Whether the game is paused, and so neither paid nor judged
+}
+
+// New returns a world without any games.
+func New() *World {
+	return &World{games: map[string]*game{}}
+}
+
+// Start adds a game played with scenario whose players have no units yet
+// and whose wars are decided by combat. A turn-based game only changes when
+// its turns are resolved. An ID can only be reused once its game has ended.
+func (w *World) Start(id string, players []string, scenario *gamelogic.Scenario, combat gamelogic.Combat, turnBased bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.games[id]; ok {
+		return fmt.Errorf("%w: %s", ErrGameExists, id)
+	}
+	g := &game{
+		scenario:  scenario,
+		combat:    combat,
+		players:   map[string]gamelogic.Player{},
+		turnBased: turnBased,
+		gold:      map[string]int{},
+		owners:    map[gamelogic.Location]string{},
+		started:   time.Now(),
+		fielded:   map[string]bool{},
+		held:      map[string]int{},
+		lastIDs:   map[string]int{},
+	}
+	for _, username := range players {
+		g.players[username] = gamelogic.Player{Username: username, Units: map[int]gamelogic.Unit{}}
+		g.gold[username] = scenario.Rules.StartingGold
+	}
+	w.games[id] = g
+	return nil
+}
+
+// End removes a game, played to the end or abandoned, and frees its ID.
+func (w *World) End(id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.games[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrNoGame, id)
+	}
+	delete(w.games, id)
+	return nil
+}
+
+// Spawn adds a player's new unit.
+func (w *World) Spawn(game string, spawn gamelogic.UnitSpawn) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.player(game, spawn.Username); err != nil {
+		return err
+	}
+	g := w.games[game]
+	if g.turnBased {
+		return fmt.Errorf("%w: spawns are ordered for the end of a turn", ErrTurnBased)
+	}
+	if err := g.spawn(spawn.Username, spawn.Unit); err != nil {
+		return err
+	}
+	g.claim(game)
+	return nil
+}
+
+// spawn adds a fresh unit to a player of the game, who must exist, and pays
+// for it. Its ID must be above every ID the player has used, so IDs of
+// units that died are not reused.
+// Units can only be spawned in territories the player controls, or by a
+// player founding their army, with neither units nor territories, anywhere
+// nobody owns or occupies.
+func (g *game) spawn(username string, unit gamelogic.Unit) error {
+	if !g.scenario.Map.Has(unit.Location) {
+		return fmt.Errorf("%w: %s", ErrNotOnMap, unit.Location)
+	}
+	ut, ok := g.scenario.Rules.Unit(unit.Rank)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRank, unit.Rank)
+	}
+	units := g.players[username].Units
+	if unit.ID <= g.lastIDs[username] {
+		return fmt.Errorf("%w: %s's unit %d, new units need IDs above %d", ErrUnitExists, username, unit.ID, g.lastIDs[username])
+	}
+	founding := len(units) == 0 && len(g.owned(username)) == 0 &&
+		g.owners[unit.Location] == "" && len(g.playersIn(unit.Location)) == 0
+	if !founding && !g.controls(username, unit.Location) {
+		return fmt.Errorf("%w: %s does not control %s", ErrNotHeld, username, unit.Location)
+	}
+	if ut.Cost > g.gold[username] {
+		return fmt.Errorf("%w: %s has %d gold, a(n) %s costs %d", ErrCannotAfford, username, g.gold[username], ut.Rank, ut.Cost)
+	}
+	g.gold[username] -= ut.Cost
+	// Units join fresh, whatever the player claims
+	unit.Damage, unit.XP = 0, 0
+	units[unit.ID] = unit
+	g.lastIDs[username] = unit.ID
+	g.assigned = max(g.assigned, unit.ID)
+	g.fielded[username] = true
+	return nil
+}
+
+// Move relocates the moved units the player has, unless the map does not
+// let any of them make the move, and fights the wars the move starts by
+// bringing them to other players' units. It returns the discrepancies between
+// the world and the player's own view of their army, as published with the
+// move, where none means the player is in sync, and the results of the wars.
+func (w *World) Move(game string, mv gamelogic.ArmyMove) ([]string, []gamelogic.WarResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, err := w.player(game, mv.Player.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+	g := w.games[game]
+	if g.turnBased {
+		return nil, nil, fmt.Errorf("%w: moves are ordered for the end of a turn", ErrTurnBased)
+	}
+	var moved []gamelogic.Unit
+	for _, u := range mv.Units {
+		unit, ok := p.Units[u.ID]
+		if !ok {
+			continue
+		}
+		if err := g.scenario.CheckMove(unit, mv.ToLocation); err != nil {
+			return Diff(p, mv.Player), nil, fmt.Errorf("%w: %v", ErrIllegalMove, err)
+		}
+		unit.Location = mv.ToLocation
+		moved = append(moved, unit)
+	}
+	for _, unit := range moved {
+		p.Units[unit.ID] = unit
+	}
+	// The player's view is of their army before any war the move starts
+	diffs := Diff(p, mv.Player)
+	var wars []gamelogic.WarResult
+	if len(moved) > 0 {
+		wars = g.fight(mv.ToLocation, map[string]bool{mv.Player.Username: true})
+	}
+	g.claim(game)
+	return diffs, wars, nil
+}
+
+// War resolves a war between two players of a game from their armies in
+// the world, with a fresh seed, and settles it. It reports false, changing
+// nothing, if the players have no units in the same place, as after Move has
+// already fought the war.
+func (w *World) War(game, attacker, defender string) (gamelogic.WarResult, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	a, err := w.player(game, attacker)
+	if err != nil {
+		return gamelogic.WarResult{}, false, err
+	}
+	d, err := w.player(game, defender)
+	if err != nil {
+		return gamelogic.WarResult{}, false, err
+	}
+	g := w.games[game]
+	if g.turnBased {
+		return gamelogic.WarResult{}, false, fmt.Errorf("%w: wars are fought when a turn is resolved", ErrTurnBased)
+	}
+	rw := gamelogic.RecognitionOfWar{Attacker: a, Defender: d}
+	result, ok := gamelogic.ResolveWar(rw, g.scenario, g.combat, rand.Int63())
+	if !ok {
+		return gamelogic.WarResult{}, false, nil
+	}
+	g.settle(result)
+	g.claim(game)
+	return result, true, nil
+}
+
+// fight resolves wars in loc, two players at a time, with fresh seeds until
+// only one player has units there, and settles them. Players who moved in
+// attack those who were there already.
+func (g *game) fight(loc gamelogic.Location, movedIn map[string]bool) []gamelogic.WarResult {
+	var wars []gamelogic.WarResult
+	for {
+		present := g.playersIn(loc)
+		if len(present) < 2 {
+			return wars
+		}
+		attacker, defender := present[0], present[1]
+		if movedIn[defender] && !movedIn[attacker] {
+			attacker, defender = defender, attacker
+		}
+		rw := gamelogic.RecognitionOfWar{Attacker: g.players[attacker], Defender: g.players[defender]}
+		result := gamelogic.ResolveWarIn(rw, loc, g.scenario, g.combat, rand.Int63())
+		g.settle(result)
+		wars = append(wars, result)
+	}
+}
+
+// settle applies the result of a war: the units killed are removed and the
+// survivors carry their wounds and experience.
+func (g *game) settle(result gamelogic.WarResult) {
+	for username, ids := range result.Casualties {
+		for _, id := range ids {
+			delete(g.players[username].Units, id)
+		}
+	}
+	for username, units := range result.Survivors {
+		for _, unit := range units {
+			g.players[username].Units[unit.ID] = unit
+		}
+	}
+}
+
+// assignID returns a unit ID no player of the game has used.
+func (g *game) assignID() int {
+	g.assigned++
+	return g.assigned
+}
+
+// State returns a snapshot of a game taken at now.
+func (w *World) State(game string, now time.Time) (gamelogic.WorldState, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return gamelogic.WorldState{}, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	ws := gamelogic.WorldState{Game: game, Scenario: *g.scenario, AsOf: now}
+	for _, p := range g.players {
+		ws.Players = append(ws.Players, gamelogic.Player{Username: p.Username, Units: maps.Clone(p.Units)})
+	}
+	sort.Slice(ws.Players, func(i, j int) bool { return ws.Players[i].Username < ws.Players[j].Username })
+	ws.Treasuries = g.treasuries()
+	ws.Owners = maps.Clone(g.owners)
+	ws.LastIDs = maps.Clone(g.lastIDs)
+	return ws, nil
+}
+
+// Games returns the ID of every game being played, sorted.
+func (w *World) Games() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	games := make([]string, 0, len(w.games))
+	for game, g := range w.games {
+		if g.over == nil {
+			games = append(games, game)
+		}
+	}
+	sort.Strings(games)
+	return games
+}
+
+// SetPaused pauses or resumes a game.
+func (w *World) SetPaused(game string, paused bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	g.paused = paused
+	return nil
+}
+
+// Paused reports whether a game is paused.
+func (w *World) Paused(game string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g, ok := w.games[game]
+	return ok && g.paused
+}
+
+// player returns a player of a game that is still being played. The caller
+// must hold w.mu.
+func (w *World) player(game, username string) (gamelogic.Player, error) {
+	g, ok := w.games[game]
+	if !ok {
+		return gamelogic.Player{}, fmt.Errorf("%w: %s", ErrNoGame, game)
+	}
+	if g.over != nil {
+		return gamelogic.Player{}, fmt.Errorf("%w: %s", ErrGameOver, game)
+	}
+	p, ok := g.players[username]
+	if !ok {
+		return gamelogic.Player{}, fmt.Errorf("%w: %s is not in %s", ErrNotPlayer, username, game)
+	}
+	return p, nil
+}
+
+// playersIn returns the players with units in loc, sorted by username.
+func (g *game) playersIn(loc gamelogic.Location) []string {
+	var present []string
+	for username, p := range g.players {
+		for _, unit := range p.Units {
+			if unit.Location == loc {
+				present = append(present, username)
+				break
+			}
+		}
+	}
+	sort.Strings(present)
+	return present
+}
+
+// Diff describes how a player's claimed army differs from the world's, one
+// line per unit, sorted by unit ID.
+func Diff(want, got gamelogic.Player) []string {
+	var ids []int
+	for id := range want.Units {
+		ids = append(ids, id)
+	}
+	for id := range got.Units {
+		if _, ok := want.Units[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	var diffs []string
+	for _, id := range ids {
+		w, inWorld := want.Units[id]
+		g, claimed := got.Units[id]
+		switch {
+		case !claimed:
+			diffs = append(diffs, fmt.Sprintf("unit %d: missing, should be %s in %s", id, w.Rank, w.Location))
+		case !inWorld:
+			diffs = append(diffs, fmt.Sprintf("unit %d: %s in %s does not exist", id, g.Rank, g.Location))
+		case w.Rank != g.Rank || w.Location != g.Location:
+			diffs = append(diffs, fmt.Sprintf("unit %d: %s in %s, should be %s in %s", id, g.Rank, g.Location, w.Rank, w.Location))
+		case w != g:
+			diffs = append(diffs, fmt.Sprintf("unit %d: %d damage and %d XP, should be %d damage and %d XP", id, g.Damage, g.XP, w.Damage, w.XP))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,161 @@
+package world
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+func spawn(t *testing.T, w *World, username string, id int, rank gamelogic.UnitRank, loc gamelogic.Location) error {
+	t.Helper()
+	unit := gamelogic.Unit{ID: id, Rank: rank, Location: loc}
+	return w.Spawn("friday", gamelogic.UnitSpawn{Username: username, Unit: unit})
+}
+
+func TestSpawnAfterLosingWarNeedsNewID(t *testing.T) {
+	w := New()
+	w.Start("friday", []string{"alice", "bob"}, gamelogic.DefaultScenario(), gamelogic.PowerCombat{}, false)
+	if err := spawn(t, w, "alice", 1, gamelogic.RankInfantry, "europe"); err != nil {
+		t.Fatalf("could not spawn alice's unit: %v", err)
+	}
+	if err := spawn(t, w, "bob", 1, gamelogic.RankArtillery, "asia"); err != nil {
+		t.Fatalf("could not spawn bob's unit: %v", err)
+	}
+
+	ws, _ := w.State("friday", time.Now())
+	alice := ws.Players[0]
+	mv := gamelogic.ArmyMove{Player: alice, Units: []gamelogic.Unit{alice.Units[1]}, ToLocation: "asia"}
+	_, wars, err := w.Move("friday", mv)
+	if err != nil {
+		t.Fatalf("could not move: %v", err)
+	}
+	if len(wars) != 1 || wars[0].Winner != "bob" {
+		t.Fatalf("move fought %+v, want a war bob won", wars)
+	}
+
+	if err := spawn(t, w, "alice", 1, gamelogic.RankInfantry, "europe"); !errors.Is(err, ErrUnitExists) {
+		t.Errorf("respawning the dead unit's ID returned %v, want %v", err, ErrUnitExists)
+	}
+	if err := spawn(t, w, "alice", 2, gamelogic.RankInfantry, "europe"); err != nil {
+		t.Fatalf("could not spawn with a new ID: %v", err)
+	}
+	ws, _ = w.State("friday", time.Now())
+	if got := ws.LastIDs["alice"]; got != 2 {
+		t.Errorf("alice's last ID = %d, want 2", got)
+	}
+}
+
+func TestTurnSpawnsAreAssignedNewIDs(t *testing.T) {
+	w := New()
+	w.Start("friday", []string{"alice", "bob"}, gamelogic.DefaultScenario(), gamelogic.PowerCombat{}, true)
+
+	report, err := w.ResolveTurn("friday", []gamelogic.Orders{
+		{Username: "alice", Turn: 1, Spawns: []gamelogic.Unit{{Rank: gamelogic.RankInfantry, Location: "europe"}}},
+		{Username: "bob", Turn: 1, Spawns: []gamelogic.Unit{{Rank: gamelogic.RankArtillery, Location: "asia"}}},
+	})
+	if err != nil {
+		t.Fatalf("could not resolve turn 1: %v", err)
+	}
+	if len(report.Rejected) > 0 {
+		t.Fatalf("turn 1 rejected orders: %v", report.Rejected)
+	}
+	first := report.Revealed[0].Spawns[0].ID
+	if bob := report.Revealed[1].Spawns[0].ID; bob == first {
+		t.Fatalf("alice and bob were both given unit ID %d", first)
+	}
+
+	report, err = w.ResolveTurn("friday", []gamelogic.Orders{
+		{Username: "alice", Turn: 2, Moves: []gamelogic.MoveOrder{{Units: []int{first}, ToLocation: "asia"}}},
+	})
+	if err != nil {
+		t.Fatalf("could not resolve turn 2: %v", err)
+	}
+	if len(report.Wars) != 1 || report.Wars[0].Winner != "bob" {
+		t.Fatalf("turn 2 wars = %+v, want one won by bob", report.Wars)
+	}
+
+	report, err = w.ResolveTurn("friday", []gamelogic.Orders{
+		{Username: "alice", Turn: 3, Spawns: []gamelogic.Unit{{ID: first, Rank: gamelogic.RankInfantry, Location: "europe"}}},
+	})
+	if err != nil {
+		t.Fatalf("could not resolve turn 3: %v", err)
+	}
+	if len(report.Rejected) > 0 {
+		t.Fatalf("turn 3 rejected orders: %v", report.Rejected)
+	}
+	if again := report.Revealed[0].Spawns[0].ID; again <= first {
+		t.Errorf("respawned unit got ID %d, want one above %d", again, first)
+	}
+}
+
+func TestEndFreesGameID(t *testing.T) {
+	w := New()
+	if err := w.Start("friday", []string{"alice", "bob"}, gamelogic.DefaultScenario(), gamelogic.PowerCombat{}, false); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	if err := spawn(t, w, "alice", 1, gamelogic.RankInfantry, "europe"); err != nil {
+		t.Fatalf("could not spawn alice's unit: %v", err)
+	}
+	if err := w.Start("friday", []string{"carol", "dave"}, gamelogic.DefaultScenario(), gamelogic.PowerCombat{}, false); !errors.Is(err, ErrGameExists) {
+		t.Errorf("starting a game twice returned %v, want %v", err, ErrGameExists)
+	}
+
+	if err := w.End("friday"); err != nil {
+		t.Fatalf("could not end: %v", err)
+	}
+	if games := w.Games(); len(games) != 0 {
+		t.Errorf("ended game is still played: %v", games)
+	}
+	if err := w.Start("friday", []string{"carol", "dave"}, gamelogic.DefaultScenario(), gamelogic.PowerCombat{}, false); err != nil {
+		t.Fatalf("could not reuse the ID of an ended game: %v", err)
+	}
+	if err := spawn(t, w, "carol", 1, gamelogic.RankInfantry, "europe"); err != nil {
+		t.Errorf("could not spawn in the new game: %v", err)
+	}
+	if err := spawn(t, w, "alice", 2, gamelogic.RankInfantry, "asia"); !errors.Is(err, ErrNotPlayer) {
+		t.Errorf("player of the ended game spawned with %v, want %v", err, ErrNotPlayer)
+	}
+}
+
+func TestMoveFightsWarBeforeRecognition(t *testing.T) {
+	w := New()
+	w.Start("friday", []string{"alice", "bob"}, gamelogic.DefaultScenario(), gamelogic.PowerCombat{}, false)
+	if err := spawn(t, w, "alice", 1, gamelogic.RankArtillery, "europe"); err != nil {
+		t.Fatalf("could not spawn alice's unit: %v", err)
+	}
+	if err := spawn(t, w, "bob", 1, gamelogic.RankInfantry, "asia"); err != nil {
+		t.Fatalf("could not spawn bob's unit: %v", err)
+	}
+
+	// bob recognises the war before the server has seen alice's move
+	if _, fought, err := w.War("friday", "alice", "bob"); err != nil || fought {
+		t.Fatalf("war before the move: fought %v, %v; want none", fought, err)
+	}
+	// Players publish their army as it is after the move
+	ws, _ := w.State("friday", time.Now())
+	alice := ws.Players[0]
+	unit := alice.Units[1]
+	unit.Location = "asia"
+	alice.Units[1] = unit
+	mv := gamelogic.ArmyMove{Player: alice, Units: []gamelogic.Unit{unit}, ToLocation: "asia"}
+	diffs, wars, err := w.Move("friday", mv)
+	if err != nil {
+		t.Fatalf("could not move: %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("alice is out of sync: %v", diffs)
+	}
+	if len(wars) != 1 {
+		t.Fatalf("move fought %d wars, want 1", len(wars))
+	}
+	if got := wars[0]; got.Attacker != "alice" || got.Defender != "bob" || got.Location != "asia" || got.Winner != "alice" {
+		t.Errorf("war = %+v, want alice attacking bob in asia and winning", got)
+	}
+
+	// The recognition arriving after the move finds the war already fought
+	if _, fought, err := w.War("friday", "alice", "bob"); err != nil || fought {
+		t.Errorf("war after the move: fought %v, %v; want none", fought, err)
+	}
+}
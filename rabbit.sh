@@ -8,7 +8,8 @@ start_or_run () {
         docker start peril_rabbitmq
     else
         echo "Peril RabbitMQ container not found, creating a new one..."
-        docker run -d --name peril_rabbitmq -p 5672:5672 -p 15672:15672 rabbitmq:3.13-management
+        docker build -t peril_rabbitmq "$(dirname "$0")"
+        docker run -d --name peril_rabbitmq -p 5672:5672 -p 15672:15672 -p 61613:61613 peril_rabbitmq
     fi
 }
 